@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/module"
+)
+
+type CacheConfig struct {
+	Dir string `json:"dir"`
+	TTL string `json:"ttl"`
+}
+
+// Cache is a read-through cache of repository assets, stored by SHA-256 hash,
+// where version queries (`@v/list` and `@latest`) are refreshed after the TTL
+type Cache struct {
+	Dir string
+	TTL time.Duration
+}
+
+const defaultCacheTTL = 5 * time.Minute
+
+func newCache(cacheConfig *CacheConfig, baseDir string) (*Cache, error) {
+	cache := &Cache{
+		Dir: cacheConfig.Dir,
+		TTL: defaultCacheTTL,
+	}
+
+	if cache.Dir == "" {
+		userCacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("Error resolving default cache directory: %w", err)
+		}
+		cache.Dir = filepath.Join(userCacheDir, "goxm")
+	} else if !filepath.IsAbs(cache.Dir) {
+		cache.Dir = filepath.Join(baseDir, cache.Dir)
+	}
+
+	if cacheConfig.TTL != "" {
+		ttl, err := time.ParseDuration(cacheConfig.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("Malformed cache TTL: %v: %w", cacheConfig.TTL, err)
+		}
+		cache.TTL = ttl
+	}
+
+	return cache, nil
+}
+
+func (c *Cache) Get(ctx context.Context, repository Repository, modPath, attifact string) (io.ReadCloser, int, error) {
+	refPath, err := c.refPath(modPath, attifact)
+	if err != nil {
+		// Assets that can not be cached are passed through
+		return repository.Get(ctx, modPath, attifact)
+	}
+
+	versionQuery := attifact == "@latest" || attifact == "@v/list"
+
+	blob, refTime, err := c.openRef(refPath)
+	if err == nil {
+		if !versionQuery || time.Since(refTime) < c.TTL {
+			logf("Got cached asset: %v/%v", modPath, attifact)
+			return blob, 0, nil
+		}
+		blob.Close()
+	}
+
+	reader, status, err := repository.Get(ctx, modPath, attifact)
+	if err != nil {
+		// Serve stale version queries if the repository is unavailable,
+		// but not if the repository responded that the module does not
+		// exist or can not be accessed
+		if !isRepositoryUnavailable(err) {
+			return nil, status, err
+		}
+		if blob, _, staleErr := c.openRef(refPath); staleErr == nil {
+			logf("%v", err)
+			logf("Got stale cached asset: %v/%v", modPath, attifact)
+			return blob, 0, nil
+		}
+		return nil, status, err
+	}
+	defer reader.Close()
+
+	blob, err = c.put(refPath, reader)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("Error caching asset: %v/%v: %w", modPath, attifact, err)
+	}
+
+	return blob, 0, nil
+}
+
+// GetOffline returns the cached asset, regardless of the TTL,
+// without fetching the asset from the repository
+func (c *Cache) GetOffline(modPath, attifact string) (io.ReadCloser, int, error) {
+	refPath, err := c.refPath(modPath, attifact)
+	if err != nil {
+		return nil, http.StatusNotFound, fmt.Errorf("Asset not available offline: %v/%v: %w", modPath, attifact, err)
+	}
+
+	blob, _, err := c.openRef(refPath)
+	if err != nil {
+		return nil, http.StatusNotFound, fmt.Errorf("Asset not available offline: %v/%v: %w", modPath, attifact, err)
+	}
+	logf("Got cached asset: %v/%v", modPath, attifact)
+
+	return blob, 0, nil
+}
+
+// put stores the content in the cache and updates the reference to it
+func (c *Cache) put(refPath string, reader io.Reader) (*os.File, error) {
+	blobDir := filepath.Join(c.Dir, "blobs")
+	err := os.MkdirAll(blobDir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpFile, err := os.CreateTemp(blobDir, ".blob.*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmpFile, hash), reader)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	blobHash := hex.EncodeToString(hash.Sum(nil))
+	blobPath := filepath.Join(blobDir, blobHash)
+
+	err = os.Chmod(tmpFile.Name(), 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Rename(tmpFile.Name(), blobPath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(refPath), 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeFileAtomic(refPath, []byte(blobHash+"\n"))
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Open(blobPath)
+}
+
+// openRef opens the content referenced by the reference file
+// and returns the time the reference was last updated
+func (c *Cache) openRef(refPath string) (*os.File, time.Time, error) {
+	refInfo, err := os.Stat(refPath)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	refData, err := os.ReadFile(refPath)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	blobHash := strings.TrimSpace(string(refData))
+	if _, err := hex.DecodeString(blobHash); err != nil || len(blobHash) != sha256.Size*2 {
+		return nil, time.Time{}, fmt.Errorf("Malformed cache reference: %v: %w", refPath, fs.ErrNotExist)
+	}
+
+	blob, err := os.Open(filepath.Join(c.Dir, "blobs", blobHash))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return blob, refInfo.ModTime(), nil
+}
+
+func (c *Cache) refPath(modPath, attifact string) (string, error) {
+	escapedPath, err := module.EscapePath(modPath)
+	if err != nil {
+		return "", err
+	}
+
+	if attifact != "@latest" {
+		asset, ok := strings.CutPrefix(attifact, "@v/")
+		if !ok || asset == "" || strings.ContainsAny(asset, "/\\") || strings.HasPrefix(asset, ".") {
+			return "", errors.New("Asset path not supported")
+		}
+	}
+
+	return filepath.Join(c.Dir, "refs", filepath.FromSlash(escapedPath), filepath.FromSlash(attifact)), nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type MockRepository struct {
+	GetFunc func(ctx context.Context, module, attifact string) (io.ReadCloser, int, error)
+	PutFunc func(ctx context.Context, module, version string, goMod, goInfo, goZip, goHashes, goSig Asset, opts PutOptions) error
+}
+
+func (r *MockRepository) Get(ctx context.Context, module, attifact string) (io.ReadCloser, int, error) {
+	return r.GetFunc(ctx, module, attifact)
+}
+
+func (r *MockRepository) Put(ctx context.Context, module, version string, goMod, goInfo, goZip, goHashes, goSig Asset, opts PutOptions) error {
+	return r.PutFunc(ctx, module, version, goMod, goInfo, goZip, goHashes, goSig, opts)
+}
+
+func TestCacheGet(t *testing.T) {
+	cache := &Cache{Dir: t.TempDir(), TTL: time.Hour}
+
+	var requests []string
+	var repoErr error
+
+	repo := &MockRepository{
+		GetFunc: func(ctx context.Context, module, attifact string) (io.ReadCloser, int, error) {
+			requests = append(requests, attifact)
+			if repoErr != nil {
+				return nil, http.StatusNotFound, repoErr
+			}
+			return io.NopCloser(bytes.NewReader([]byte(module + "/" + attifact))), 0, nil
+		},
+	}
+
+	readAsset := func(attifact string) (string, error) {
+		reader, _, err := cache.Get(context.Background(), repo, "github.com/go-goxm/Module1", attifact)
+		if err != nil {
+			return "", err
+		}
+		defer reader.Close()
+
+		data, err := io.ReadAll(reader)
+		require.Nil(t, err)
+		return string(data), nil
+	}
+
+	for i := 0; i < 2; i++ {
+		data, err := readAsset("@v/v0.1.0.zip")
+		require.Nil(t, err, err)
+		require.Equal(t, "github.com/go-goxm/Module1/@v/v0.1.0.zip", data)
+
+		data, err = readAsset("@v/list")
+		require.Nil(t, err, err)
+		require.Equal(t, "github.com/go-goxm/Module1/@v/list", data)
+	}
+	require.Equal(t, []string{"@v/v0.1.0.zip", "@v/list"}, requests)
+
+	// Module paths are stored using the GOPROXY case escaping
+	require.FileExists(t, filepath.Join(cache.Dir, "refs/github.com/go-goxm/!module1/@v/v0.1.0.zip"))
+
+	// Version queries are refreshed after the TTL, but versioned assets are not
+	cache.TTL = 0
+	requests = nil
+
+	data, err := readAsset("@v/list")
+	require.Nil(t, err, err)
+	require.Equal(t, "github.com/go-goxm/Module1/@v/list", data)
+
+	data, err = readAsset("@v/v0.1.0.zip")
+	require.Nil(t, err, err)
+	require.Equal(t, "github.com/go-goxm/Module1/@v/v0.1.0.zip", data)
+
+	require.Equal(t, []string{"@v/list"}, requests)
+
+	// Stale version queries are served if the repository is unavailable
+	for _, err := range []error{
+		fmt.Errorf("Mock Unavailable: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")}),
+		&goProxyStatusError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"},
+		&goProxyStatusError{StatusCode: http.StatusTooManyRequests, Status: "429 Too Many Requests"},
+	} {
+		repoErr = err
+		requests = nil
+
+		data, err = readAsset("@v/list")
+		require.Nil(t, err, err)
+		require.Equal(t, "github.com/go-goxm/Module1/@v/list", data)
+
+		_, err = readAsset("@latest")
+		require.Error(t, err)
+
+		require.Equal(t, []string{"@v/list", "@latest"}, requests)
+	}
+
+	// But not if the repository responds that the module
+	// does not exist or can not be accessed
+	for _, err := range []error{
+		fmt.Errorf("Mock Not Found"),
+		&goProxyStatusError{StatusCode: http.StatusNotFound, Status: "404 Not Found"},
+		&goProxyStatusError{StatusCode: http.StatusForbidden, Status: "403 Forbidden"},
+	} {
+		repoErr = err
+
+		_, err = readAsset("@v/list")
+		require.ErrorIs(t, err, repoErr)
+	}
+}
+
+func TestCacheConfig(t *testing.T) {
+	configDir := t.TempDir()
+	isolateConfig(t, configDir)
+
+	err := os.WriteFile(filepath.Join(configDir, defaultConfigName), []byte(`{
+		"cache": {
+			"dir": "cache",
+			"ttl": "1m"
+		},
+		"repos": {}
+	}`), 0o644)
+	require.Nil(t, err)
+
+	chdir(t, configDir)
+
+	config, err := LoadDefaultConfig()
+	require.Nilf(t, err, "Error loading default config: %v", err)
+	require.Equal(t, &Cache{Dir: filepath.Join(configDir, "cache"), TTL: time.Minute}, config.Cache)
+
+	_, err = LoadConfig(strings.NewReader(`{"cache": {"dir": "cache", "ttl": "forever"}}`))
+	require.Error(t, err)
+}
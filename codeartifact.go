@@ -3,7 +3,7 @@ package main
 import (
 	"bytes"
 	"context"
-	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -35,6 +35,30 @@ type CodeArtifactClient interface {
 		params *codeartifact.PublishPackageVersionInput,
 		optFns ...func(*codeartifact.Options),
 	) (*codeartifact.PublishPackageVersionOutput, error)
+
+	ListPackageVersionAssets(
+		ctx context.Context,
+		params *codeartifact.ListPackageVersionAssetsInput,
+		optFns ...func(*codeartifact.Options),
+	) (*codeartifact.ListPackageVersionAssetsOutput, error)
+
+	DeletePackageVersions(
+		ctx context.Context,
+		params *codeartifact.DeletePackageVersionsInput,
+		optFns ...func(*codeartifact.Options),
+	) (*codeartifact.DeletePackageVersionsOutput, error)
+
+	DescribePackageVersion(
+		ctx context.Context,
+		params *codeartifact.DescribePackageVersionInput,
+		optFns ...func(*codeartifact.Options),
+	) (*codeartifact.DescribePackageVersionOutput, error)
+
+	UpdatePackageVersionsStatus(
+		ctx context.Context,
+		params *codeartifact.UpdatePackageVersionsStatusInput,
+		optFns ...func(*codeartifact.Options),
+	) (*codeartifact.UpdatePackageVersionsStatusOutput, error)
 }
 
 type CodeArtifactRepoConfig struct {
@@ -50,47 +74,45 @@ type CodeArtifactRepoConfig struct {
 
 func (r *CodeArtifactRepoConfig) Get(ctx context.Context, module, attifact string) (io.ReadCloser, int, error) {
 	if attifact == "@latest" {
-		return nil, http.StatusNotFound, fmt.Errorf("Not implemented: %v/%v", module, attifact)
-	}
+		versions, err := r.listVersions(ctx, module)
+		if err != nil {
+			return nil, http.StatusNotFound, err
+		}
 
-	pkg := codeArtPackageEscape(module)
-	namespace := codeArtNamespaceDefault(r.Namespace)
+		latest := latestVersion(versions)
+		if latest == "" {
+			return nil, http.StatusNotFound, fmt.Errorf("No CodeArtifact versions found: %v/%v", module, attifact)
+		}
 
-	client, err := r.getClient(ctx)
-	if err != nil {
-		return nil, http.StatusForbidden, err
+		return r.Get(ctx, module, "@v/"+latest+".info")
 	}
 
 	if attifact == "@v/list" {
-		input := &codeartifact.ListPackageVersionsInput{
-			Package:     aws.String(pkg),
-			Domain:      r.Domain,
-			Namespace:   namespace,
-			Repository:  r.Repository,
-			DomainOwner: r.DomainOwner,
-			Format:      codeartifactTypes.PackageFormatGeneric,
-			Status:      codeartifactTypes.PackageVersionStatusPublished,
-			MaxResults:  aws.Int32(50),
-		}
-
-		output, err := client.ListPackageVersions(ctx, input)
+		versions, err := r.listVersions(ctx, module)
 		if err != nil {
-			return nil, http.StatusNotFound, fmt.Errorf("Error listing CodeArtifact versions: %v: %w", codeArtListVersionsString(input), err)
+			return nil, http.StatusNotFound, err
 		}
-		logf("Got CodeArtifact versions: %v Count:%d", codeArtListVersionsString(input), len(output.Versions))
 
 		buf := bytes.NewBuffer(nil)
-		for _, version := range output.Versions {
-			fmt.Fprintf(buf, "%v\n", aws.ToString(version.Version))
+		for _, version := range listedVersions(versions) {
+			fmt.Fprintf(buf, "%v\n", version)
 		}
 
 		return io.NopCloser(buf), 0, nil
 	}
 
+	pkg := codeArtPackageEscape(module)
+	namespace := codeArtNamespaceDefault(r.Namespace)
+
+	client, err := r.getClient(ctx)
+	if err != nil {
+		return nil, http.StatusForbidden, err
+	}
+
 	asset := attifact[3:]
 	assetExt := path.Ext(asset)
 
-	if !slices.Contains([]string{".info", ".mod", ".zip"}, assetExt) {
+	if !slices.Contains(assetExtensions, assetExt) {
 		return nil, http.StatusForbidden, fmt.Errorf("Asset extension not supported: %v/%v", module, attifact)
 	}
 
@@ -116,7 +138,48 @@ func (r *CodeArtifactRepoConfig) Get(ctx context.Context, module, attifact strin
 	return output.Asset, 0, nil
 }
 
-func (r *CodeArtifactRepoConfig) Put(ctx context.Context, modPath, version string, goModData, infoData, zipData []byte) error {
+func (r *CodeArtifactRepoConfig) listVersions(ctx context.Context, module string) ([]string, error) {
+
+	client, err := r.getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &codeartifact.ListPackageVersionsInput{
+		Package:     aws.String(codeArtPackageEscape(module)),
+		Domain:      r.Domain,
+		Namespace:   codeArtNamespaceDefault(r.Namespace),
+		Repository:  r.Repository,
+		DomainOwner: r.DomainOwner,
+		Format:      codeartifactTypes.PackageFormatGeneric,
+		Status:      codeartifactTypes.PackageVersionStatusPublished,
+		MaxResults:  aws.Int32(50),
+	}
+
+	// Versions are returned in pages, so follow the
+	// `NextToken` until all of the versions are listed
+	var versions []string
+	for {
+		output, err := client.ListPackageVersions(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("Error listing CodeArtifact versions: %v: %w", codeArtListVersionsString(input), err)
+		}
+		logf("Got CodeArtifact versions: %v Count:%d", codeArtListVersionsString(input), len(output.Versions))
+
+		for _, version := range output.Versions {
+			versions = append(versions, aws.ToString(version.Version))
+		}
+
+		if aws.ToString(output.NextToken) == "" {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+
+	return sortVersions(versions), nil
+}
+
+func (r *CodeArtifactRepoConfig) Put(ctx context.Context, modPath, version string, goMod, info, zip, hashes, sig Asset, opts PutOptions) error {
 
 	client, err := r.getClient(ctx)
 	if err != nil {
@@ -126,70 +189,219 @@ func (r *CodeArtifactRepoConfig) Put(ctx context.Context, modPath, version strin
 	pkg := codeArtPackageEscape(modPath)
 	namespace := codeArtNamespaceDefault(r.Namespace)
 
-	// Publish info file
-	input := &codeartifact.PublishPackageVersionInput{
-		AssetName:      aws.String(version + ".info"),
-		AssetSHA256:    aws.String(codeArtAssetSHA256(infoData)),
-		AssetContent:   bytes.NewReader(infoData),
-		Package:        aws.String(pkg),
-		PackageVersion: aws.String(version),
-		Domain:         r.Domain,
-		Namespace:      namespace,
-		Repository:     r.Repository,
-		DomainOwner:    r.DomainOwner,
-		Format:         codeartifactTypes.PackageFormatGeneric,
-		Unfinished:     aws.Bool(true),
+	existing, err := r.listAssetHashes(ctx, modPath, version)
+	if err != nil {
+		return err
+	}
+
+	// The version is only published when the last asset is published,
+	// so a version left `Unfinished` was interrupted while publishing
+	var unfinished bool
+	if len(existing) > 0 {
+		status, err := r.versionStatus(ctx, modPath, version)
+		if err != nil {
+			return err
+		}
+		unfinished = status == codeartifactTypes.PackageVersionStatusUnfinished
+	}
+
+	state, err := checkExistingAssets(modPath, version, existing, unfinished, goMod, info, zip, hashes, sig, opts)
+	if err != nil {
+		return err
+	}
+
+	type extAsset struct {
+		ext   string
+		asset Asset
+	}
+
+	assets := []extAsset{
+		{".sig", sig},
+		{".hashes", hashes},
+		{".info", info},
+		{".mod", goMod},
+		{".zip", zip},
+	}
+
+	// The signature is nil if the version is not signed
+	assets = slices.DeleteFunc(assets, func(a extAsset) bool {
+		return a.asset == nil
+	})
+
+	switch state {
+	case versionPublished:
+		return nil
+
+	case versionReplaced:
+		// Assets of a version can not be replaced,
+		// so the existing version is deleted first
+		deleteInput := &codeartifact.DeletePackageVersionsInput{
+			Package:     aws.String(pkg),
+			Versions:    []string{version},
+			Domain:      r.Domain,
+			Namespace:   namespace,
+			Repository:  r.Repository,
+			DomainOwner: r.DomainOwner,
+			Format:      codeartifactTypes.PackageFormatGeneric,
+		}
+
+		deleteOutput, err := client.DeletePackageVersions(ctx, deleteInput)
+		if err == nil {
+			for _, deleteErr := range deleteOutput.FailedVersions {
+				err = fmt.Errorf("%v: %v", deleteErr.ErrorCode, aws.ToString(deleteErr.ErrorMessage))
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("Error deleting CodeArtifact version: %v Version:%v: %w", codeArtDeleteVersionsString(deleteInput), version, err)
+		}
+		logf("Deleted CodeArtifact version: %v Version:%v", codeArtDeleteVersionsString(deleteInput), version)
+
+	case versionUnfinished:
+		// Only the assets missing from the unfinished version are published
+		assets = slices.DeleteFunc(assets, func(a extAsset) bool {
+			_, ok := existing[a.ext]
+			return ok
+		})
+
+		if len(assets) == 0 {
+			updateInput := &codeartifact.UpdatePackageVersionsStatusInput{
+				Package:        aws.String(pkg),
+				Versions:       []string{version},
+				Domain:         r.Domain,
+				Namespace:      namespace,
+				Repository:     r.Repository,
+				DomainOwner:    r.DomainOwner,
+				Format:         codeartifactTypes.PackageFormatGeneric,
+				ExpectedStatus: codeartifactTypes.PackageVersionStatusUnfinished,
+				TargetStatus:   codeartifactTypes.PackageVersionStatusPublished,
+			}
+
+			updateOutput, err := client.UpdatePackageVersionsStatus(ctx, updateInput)
+			if err == nil {
+				for _, updateErr := range updateOutput.FailedVersions {
+					err = fmt.Errorf("%v: %v", updateErr.ErrorCode, aws.ToString(updateErr.ErrorMessage))
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("Error updating CodeArtifact version status: %v Version:%v: %w", codeArtUpdateVersionsStatusString(updateInput), version, err)
+			}
+			logf("Updated CodeArtifact version status: %v Version:%v Status:%v", codeArtUpdateVersionsStatusString(updateInput), version, updateInput.TargetStatus)
+		}
+	}
+
+	// Assets are published to an `Unfinished` version, which is not listed,
+	// and the version is published with the last asset
+	for i, asset := range assets {
+		err = r.publishAsset(ctx, client, &codeartifact.PublishPackageVersionInput{
+			AssetName:      aws.String(version + asset.ext),
+			AssetSHA256:    aws.String(asset.asset.SHA256()),
+			Package:        aws.String(pkg),
+			PackageVersion: aws.String(version),
+			Domain:         r.Domain,
+			Namespace:      namespace,
+			Repository:     r.Repository,
+			DomainOwner:    r.DomainOwner,
+			Format:         codeartifactTypes.PackageFormatGeneric,
+			Unfinished:     aws.Bool(i < len(assets)-1),
+		}, asset.asset)
+		if err != nil {
+			return err
+		}
 	}
 
+	return nil
+}
+
+// publishAsset publishes the asset content, which
+// is opened for the duration of the request
+func (r *CodeArtifactRepoConfig) publishAsset(ctx context.Context, client CodeArtifactClient, input *codeartifact.PublishPackageVersionInput, asset Asset) error {
+	content, err := asset.Open()
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	input.AssetContent = content
+
 	_, err = client.PublishPackageVersion(ctx, input)
 	if err != nil {
 		return fmt.Errorf("Error publishing CodeArtifact asset: %v: %w", codeArtPublishAssetString(input), err)
 	}
 	logf("Published CodeArtifact asset: %v", codeArtPublishAssetString(input))
 
-	// Publish mod file
-	input = &codeartifact.PublishPackageVersionInput{
-		AssetName:      aws.String(version + ".mod"),
-		AssetSHA256:    aws.String(codeArtAssetSHA256(goModData)),
-		AssetContent:   bytes.NewReader(goModData),
-		Package:        aws.String(pkg),
+	return nil
+}
+
+// versionStatus returns the status of the version, which
+// is `Unfinished` until all of the assets are published
+func (r *CodeArtifactRepoConfig) versionStatus(ctx context.Context, modPath, version string) (codeartifactTypes.PackageVersionStatus, error) {
+
+	client, err := r.getClient(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	input := &codeartifact.DescribePackageVersionInput{
+		Package:        aws.String(codeArtPackageEscape(modPath)),
 		PackageVersion: aws.String(version),
 		Domain:         r.Domain,
-		Namespace:      namespace,
+		Namespace:      codeArtNamespaceDefault(r.Namespace),
 		Repository:     r.Repository,
 		DomainOwner:    r.DomainOwner,
 		Format:         codeartifactTypes.PackageFormatGeneric,
-		Unfinished:     aws.Bool(true),
 	}
 
-	_, err = client.PublishPackageVersion(ctx, input)
+	output, err := client.DescribePackageVersion(ctx, input)
 	if err != nil {
-		return fmt.Errorf("Error publishing CodeArtifact asset: %v: %w", codeArtPublishAssetString(input), err)
+		return "", fmt.Errorf("Error describing CodeArtifact version: %v Version:%v: %w", codeArtDescribeVersionString(input), version, err)
 	}
-	logf("Published CodeArtifact asset: %v", codeArtPublishAssetString(input))
 
-	// Publish zip file
-	input = &codeartifact.PublishPackageVersionInput{
-		AssetName:      aws.String(version + ".zip"),
-		AssetSHA256:    aws.String(codeArtAssetSHA256(zipData)),
-		AssetContent:   bytes.NewReader(zipData),
-		Package:        aws.String(pkg),
+	return output.PackageVersion.Status, nil
+}
+
+// listAssetHashes returns the SHA-256 hashes of the assets
+// of the version, keyed by asset extension
+func (r *CodeArtifactRepoConfig) listAssetHashes(ctx context.Context, modPath, version string) (map[string]string, error) {
+
+	client, err := r.getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &codeartifact.ListPackageVersionAssetsInput{
+		Package:        aws.String(codeArtPackageEscape(modPath)),
 		PackageVersion: aws.String(version),
 		Domain:         r.Domain,
-		Namespace:      namespace,
+		Namespace:      codeArtNamespaceDefault(r.Namespace),
 		Repository:     r.Repository,
 		DomainOwner:    r.DomainOwner,
 		Format:         codeartifactTypes.PackageFormatGeneric,
-		Unfinished:     aws.Bool(false),
 	}
 
-	_, err = client.PublishPackageVersion(ctx, input)
-	if err != nil {
-		return fmt.Errorf("Error publishing CodeArtifact asset: %v: %w", codeArtPublishAssetString(input), err)
+	hashes := map[string]string{}
+	for {
+		output, err := client.ListPackageVersionAssets(ctx, input)
+		var notFoundErr *codeartifactTypes.ResourceNotFoundException
+		if errors.As(err, &notFoundErr) {
+			return hashes, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("Error listing CodeArtifact assets: %v Version:%v: %w", codeArtListAssetsString(input), version, err)
+		}
+
+		for _, asset := range output.Assets {
+			name := aws.ToString(asset.Name)
+			if strings.HasPrefix(name, version+".") {
+				hashes[name[len(version):]] = asset.Hashes[string(codeartifactTypes.HashAlgorithmSha256)]
+			}
+		}
+
+		if aws.ToString(output.NextToken) == "" {
+			break
+		}
+		input.NextToken = output.NextToken
 	}
-	logf("Published CodeArtifact asset: %v", codeArtPublishAssetString(input))
 
-	return nil
+	return hashes, nil
 }
 
 func (r *CodeArtifactRepoConfig) getClient(ctx context.Context) (CodeArtifactClient, error) {
@@ -223,11 +435,43 @@ func codeArtNamespaceDefault(namespace *string) *string {
 	return namespace
 }
 
-func codeArtAssetSHA256(data []byte) string {
-	return fmt.Sprintf("%x", sha256.Sum256(data))
+func codeArtListVersionsString(input *codeartifact.ListPackageVersionsInput) string {
+	return fmt.Sprintf(
+		"Domain:%v(%v) Repo:%v NS:%v Pkg:%v",
+		aws.ToString(input.Domain), aws.ToString(input.DomainOwner),
+		aws.ToString(input.Repository), aws.ToString(input.Namespace),
+		aws.ToString(input.Package),
+	)
 }
 
-func codeArtListVersionsString(input *codeartifact.ListPackageVersionsInput) string {
+func codeArtListAssetsString(input *codeartifact.ListPackageVersionAssetsInput) string {
+	return fmt.Sprintf(
+		"Domain:%v(%v) Repo:%v NS:%v Pkg:%v",
+		aws.ToString(input.Domain), aws.ToString(input.DomainOwner),
+		aws.ToString(input.Repository), aws.ToString(input.Namespace),
+		aws.ToString(input.Package),
+	)
+}
+
+func codeArtDescribeVersionString(input *codeartifact.DescribePackageVersionInput) string {
+	return fmt.Sprintf(
+		"Domain:%v(%v) Repo:%v NS:%v Pkg:%v",
+		aws.ToString(input.Domain), aws.ToString(input.DomainOwner),
+		aws.ToString(input.Repository), aws.ToString(input.Namespace),
+		aws.ToString(input.Package),
+	)
+}
+
+func codeArtUpdateVersionsStatusString(input *codeartifact.UpdatePackageVersionsStatusInput) string {
+	return fmt.Sprintf(
+		"Domain:%v(%v) Repo:%v NS:%v Pkg:%v",
+		aws.ToString(input.Domain), aws.ToString(input.DomainOwner),
+		aws.ToString(input.Repository), aws.ToString(input.Namespace),
+		aws.ToString(input.Package),
+	)
+}
+
+func codeArtDeleteVersionsString(input *codeartifact.DeletePackageVersionsInput) string {
 	return fmt.Sprintf(
 		"Domain:%v(%v) Repo:%v NS:%v Pkg:%v",
 		aws.ToString(input.Domain), aws.ToString(input.DomainOwner),
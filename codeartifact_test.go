@@ -3,9 +3,11 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -13,6 +15,7 @@ import (
 	codeartifactTypes "github.com/aws/aws-sdk-go-v2/service/codeartifact/types"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/exp/maps"
+	"golang.org/x/mod/sumdb/dirhash"
 )
 
 type MockCodeArtifactClient struct {
@@ -33,6 +36,30 @@ type MockCodeArtifactClient struct {
 		params *codeartifact.PublishPackageVersionInput,
 		optFns ...func(*codeartifact.Options),
 	) (*codeartifact.PublishPackageVersionOutput, error)
+
+	ListPackageVersionAssetsFunc func(
+		ctx context.Context,
+		params *codeartifact.ListPackageVersionAssetsInput,
+		optFns ...func(*codeartifact.Options),
+	) (*codeartifact.ListPackageVersionAssetsOutput, error)
+
+	DeletePackageVersionsFunc func(
+		ctx context.Context,
+		params *codeartifact.DeletePackageVersionsInput,
+		optFns ...func(*codeartifact.Options),
+	) (*codeartifact.DeletePackageVersionsOutput, error)
+
+	DescribePackageVersionFunc func(
+		ctx context.Context,
+		params *codeartifact.DescribePackageVersionInput,
+		optFns ...func(*codeartifact.Options),
+	) (*codeartifact.DescribePackageVersionOutput, error)
+
+	UpdatePackageVersionsStatusFunc func(
+		ctx context.Context,
+		params *codeartifact.UpdatePackageVersionsStatusInput,
+		optFns ...func(*codeartifact.Options),
+	) (*codeartifact.UpdatePackageVersionsStatusOutput, error)
 }
 
 func (c *MockCodeArtifactClient) GetPackageVersionAsset(
@@ -59,8 +86,41 @@ func (c *MockCodeArtifactClient) PublishPackageVersion(
 	return c.PublishPackageVersionFunc(ctx, params, optFns...)
 }
 
+func (c *MockCodeArtifactClient) ListPackageVersionAssets(
+	ctx context.Context,
+	params *codeartifact.ListPackageVersionAssetsInput,
+	optFns ...func(*codeartifact.Options),
+) (*codeartifact.ListPackageVersionAssetsOutput, error) {
+	return c.ListPackageVersionAssetsFunc(ctx, params, optFns...)
+}
+
+func (c *MockCodeArtifactClient) DeletePackageVersions(
+	ctx context.Context,
+	params *codeartifact.DeletePackageVersionsInput,
+	optFns ...func(*codeartifact.Options),
+) (*codeartifact.DeletePackageVersionsOutput, error) {
+	return c.DeletePackageVersionsFunc(ctx, params, optFns...)
+}
+
+func (c *MockCodeArtifactClient) DescribePackageVersion(
+	ctx context.Context,
+	params *codeartifact.DescribePackageVersionInput,
+	optFns ...func(*codeartifact.Options),
+) (*codeartifact.DescribePackageVersionOutput, error) {
+	return c.DescribePackageVersionFunc(ctx, params, optFns...)
+}
+
+func (c *MockCodeArtifactClient) UpdatePackageVersionsStatus(
+	ctx context.Context,
+	params *codeartifact.UpdatePackageVersionsStatusInput,
+	optFns ...func(*codeartifact.Options),
+) (*codeartifact.UpdatePackageVersionsStatusOutput, error) {
+	return c.UpdatePackageVersionsStatusFunc(ctx, params, optFns...)
+}
+
 func TestCodeArtifactModDownload(t *testing.T) {
 	t.Setenv("GOMODCACHE", t.TempDir())
+	isolateConfig(t, "./testdata")
 	chdir(t, "./testdata/ca_module1")
 
 	config, err := LoadDefaultConfig()
@@ -133,6 +193,7 @@ func TestCodeArtifactModDownload(t *testing.T) {
 
 func TestCodeArtifactGet(t *testing.T) {
 	t.Setenv("GOMODCACHE", t.TempDir())
+	isolateConfig(t, "./testdata")
 	chdir(t, "./testdata/ca_module2")
 
 	config, err := LoadDefaultConfig()
@@ -186,6 +247,7 @@ func TestCodeArtifactBuild(t *testing.T) {
 	// to avoid error on temp directory cleanup
 	t.Setenv("GOFLAGS", "-modcacherw")
 	t.Setenv("GOMODCACHE", t.TempDir())
+	isolateConfig(t, "./testdata")
 	chdir(t, "./testdata/ca_module3")
 
 	config, err := LoadDefaultConfig()
@@ -252,6 +314,14 @@ func TestCodeArtifactBuild(t *testing.T) {
 		},
 	}
 
+	// Each asset is verified against the hashes published with
+	// the version, which are read for each asset without a cache
+	for i := 0; i < 3; i++ {
+		hashesInput := *expectedResults["github.com/go-goxm/ca_module1"][0]
+		hashesInput.Asset = aws.String("v0.1.0.hashes")
+		expectedResults["github.com/go-goxm/ca_module1"] = append(expectedResults["github.com/go-goxm/ca_module1"], &hashesInput)
+	}
+
 	require.ElementsMatch(t, maps.Keys(expectedResults), maps.Keys(results))
 	for k, result := range results {
 		require.ElementsMatch(t, expectedResults[k], result)
@@ -260,12 +330,14 @@ func TestCodeArtifactBuild(t *testing.T) {
 
 func TestCodeArtifactPublish(t *testing.T) {
 	t.Setenv("GOMODCACHE", t.TempDir())
+	isolateConfig(t, "./testdata")
 	chdir(t, "./testdata/ca_module1")
 
 	config, err := LoadDefaultConfig()
 	require.Nilf(t, err, "Error loading default config: %v", err)
 
 	results := make(map[string][]*codeartifact.PublishPackageVersionInput)
+	hashesPublished := make(map[string]bool)
 
 	for mre, repo := range config.Repos {
 		modRegExp := mre
@@ -273,11 +345,65 @@ func TestCodeArtifactPublish(t *testing.T) {
 		repo := repo.(*CodeArtifactRepoConfig)
 
 		repo.client = &MockCodeArtifactClient{
+			ListPackageVersionAssetsFunc: func(
+				ctx context.Context,
+				params *codeartifact.ListPackageVersionAssetsInput,
+				optFns ...func(*codeartifact.Options),
+			) (*codeartifact.ListPackageVersionAssetsOutput, error) {
+				return nil, &codeartifactTypes.ResourceNotFoundException{}
+			},
 			PublishPackageVersionFunc: func(
 				ctx context.Context,
 				params *codeartifact.PublishPackageVersionInput,
 				optFns ...func(*codeartifact.Options),
 			) (*codeartifact.PublishPackageVersionOutput, error) {
+				// The asset content is only readable during the request
+				assetData, err := io.ReadAll(params.AssetContent)
+				require.Nil(t, err)
+				params.AssetContent = bytes.NewReader(assetData)
+
+				if strings.HasSuffix(aws.ToString(params.AssetName), ".info") {
+					// The origin depends on the clone of the Git repository,
+					// so it is checked and removed before comparing the asset
+					var info Info
+					require.Nil(t, json.Unmarshal(assetData, &info))
+					require.Equal(t, "git", info.Origin.VCS)
+					require.Equal(t, "testdata/ca_module1", info.Origin.Subdir)
+					require.Equal(t, "refs/tags/v0.1.0", info.Origin.Ref)
+					require.Len(t, info.Origin.Hash, 40)
+
+					info.Origin = nil
+					infoData, err := json.MarshalIndent(info, "", "    ")
+					require.Nil(t, err)
+
+					params.AssetContent = bytes.NewReader(infoData)
+					params.AssetSHA256 = aws.String(newBytesAsset(infoData).SHA256())
+				}
+
+				if strings.HasSuffix(aws.ToString(params.AssetName), ".hashes") {
+					// The hashes include the hash of the info, so
+					// only the hashes of the other assets are checked
+					var hashes AssetHashes
+					require.Nil(t, json.Unmarshal(assetData, &hashes))
+					require.Empty(t, results[modRegExp], "Hashes must be published first")
+
+					zipSum, err := dirhash.HashZip("../ca_module1_assets/v0.1.0.zip", dirhash.Hash1)
+					require.Nil(t, err)
+					modSum, err := goModSum(readFile(t, "../ca_module1_assets/v0.1.0.mod"))
+					require.Nil(t, err)
+
+					require.Equal(t, "github.com/go-goxm/ca_module1", hashes.Path)
+					require.Equal(t, "v0.1.0", hashes.Version)
+					require.Equal(t, zipSum, hashes.Sum)
+					require.Equal(t, modSum, hashes.GoModSum)
+					require.Equal(t, "84ab8e2a063142265a796cb95446d794a61e0568f91b56f519fd84e11e23f0a7", hashes.SHA256[".mod"])
+					require.Equal(t, "f3f283d638bd8e446d593aec7a6c5bf1e234ed9c91a611362a192fc3f508cf99", hashes.SHA256[".zip"])
+					require.Len(t, hashes.SHA256[".info"], 64)
+
+					hashesPublished[modRegExp] = true
+					return &codeartifact.PublishPackageVersionOutput{}, nil
+				}
+
 				results[modRegExp] = append(results[modRegExp], params)
 				return &codeartifact.PublishPackageVersionOutput{}, nil
 			},
@@ -332,6 +458,7 @@ func TestCodeArtifactPublish(t *testing.T) {
 	}
 
 	require.ElementsMatch(t, maps.Keys(expectedResults), maps.Keys(results))
+	require.ElementsMatch(t, maps.Keys(expectedResults), maps.Keys(hashesPublished))
 	for k, result := range results {
 		// // Use to write assets to directory
 		// for _, r := range result {
@@ -360,3 +487,243 @@ func readerToFile(t *testing.T, r io.Reader, p string) {
 	_, err = io.Copy(f, r)
 	require.Nil(t, err)
 }
+
+func TestCodeArtifactLatest(t *testing.T) {
+	repo := &CodeArtifactRepoConfig{
+		Domain:      aws.String("TestDomain1"),
+		DomainOwner: aws.String("111111111111"),
+		Repository:  aws.String("TestRepo1"),
+	}
+
+	var results []*codeartifact.GetPackageVersionAssetInput
+
+	repo.client = &MockCodeArtifactClient{
+		ListPackageVersionsFunc: func(
+			ctx context.Context,
+			params *codeartifact.ListPackageVersionsInput,
+			optFns ...func(*codeartifact.Options),
+		) (*codeartifact.ListPackageVersionsOutput, error) {
+			return &codeartifact.ListPackageVersionsOutput{
+				Versions: []codeartifactTypes.PackageVersionSummary{
+					{Version: aws.String("v0.1.0")},
+					{Version: aws.String("v0.10.0")},
+					{Version: aws.String("v0.9.0")},
+					{Version: aws.String("v1.0.0-rc.1")},
+				},
+			}, nil
+		},
+		GetPackageVersionAssetFunc: func(
+			ctx context.Context,
+			params *codeartifact.GetPackageVersionAssetInput,
+			optFns ...func(*codeartifact.Options),
+		) (*codeartifact.GetPackageVersionAssetOutput, error) {
+			results = append(results, params)
+			return &codeartifact.GetPackageVersionAssetOutput{
+				Asset: io.NopCloser(fileToReader(t, "./testdata/ca_module1_assets/v0.1.0.info")),
+			}, nil
+		},
+	}
+
+	reader, _, err := repo.Get(context.Background(), "github.com/go-goxm/ca_module1", "@latest")
+	require.Nil(t, err, err)
+	reader.Close()
+
+	expectedResults := []*codeartifact.GetPackageVersionAssetInput{
+		{
+			Asset:          aws.String("v0.10.0.info"),
+			Package:        aws.String("github.com+2Fgo-goxm+2Fca_module1"),
+			PackageVersion: aws.String("v0.10.0"),
+			Namespace:      aws.String("goxm"),
+			Repository:     aws.String("TestRepo1"),
+			Domain:         aws.String("TestDomain1"),
+			DomainOwner:    aws.String("111111111111"),
+			Format:         codeartifactTypes.PackageFormatGeneric,
+		},
+	}
+	require.Equal(t, expectedResults, results)
+}
+
+func TestCodeArtifactList(t *testing.T) {
+	repo := &CodeArtifactRepoConfig{
+		Domain:      aws.String("TestDomain1"),
+		DomainOwner: aws.String("111111111111"),
+		Repository:  aws.String("TestRepo1"),
+	}
+
+	pages := map[string]*codeartifact.ListPackageVersionsOutput{
+		"": {
+			Versions: []codeartifactTypes.PackageVersionSummary{
+				{Version: aws.String("v0.10.0")},
+				{Version: aws.String("v0.2.0")},
+			},
+			NextToken: aws.String("Page2"),
+		},
+		"Page2": {
+			Versions: []codeartifactTypes.PackageVersionSummary{
+				{Version: aws.String("v0.2.0")},
+				{Version: aws.String("v0.1.0")},
+			},
+		},
+	}
+
+	var nextTokens []string
+
+	repo.client = &MockCodeArtifactClient{
+		ListPackageVersionsFunc: func(
+			ctx context.Context,
+			params *codeartifact.ListPackageVersionsInput,
+			optFns ...func(*codeartifact.Options),
+		) (*codeartifact.ListPackageVersionsOutput, error) {
+			nextTokens = append(nextTokens, aws.ToString(params.NextToken))
+			return pages[aws.ToString(params.NextToken)], nil
+		},
+	}
+
+	reader, _, err := repo.Get(context.Background(), "github.com/go-goxm/ca_module1", "@v/list")
+	require.Nil(t, err, err)
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	require.Nil(t, err)
+	require.Equal(t, "v0.1.0\nv0.2.0\nv0.10.0\n", string(data))
+	require.Equal(t, []string{"", "Page2"}, nextTokens)
+}
+
+func TestCodeArtifactPutExisting(t *testing.T) {
+	repo := &CodeArtifactRepoConfig{
+		Domain:      aws.String("TestDomain1"),
+		DomainOwner: aws.String("111111111111"),
+		Repository:  aws.String("TestRepo1"),
+	}
+
+	goModData := []byte("module github.com/go-goxm/ca_module1\n")
+	infoData := []byte(`{"Version":"v0.1.0"}`)
+	zipData := []byte("zip")
+	hashesData := []byte("{}")
+
+	assets := []codeartifactTypes.AssetSummary{
+		{Name: aws.String("v0.1.0.hashes"), Hashes: map[string]string{"SHA-256": newBytesAsset(hashesData).SHA256()}},
+		{Name: aws.String("v0.1.0.info"), Hashes: map[string]string{"SHA-256": newBytesAsset(infoData).SHA256()}},
+		{Name: aws.String("v0.1.0.mod"), Hashes: map[string]string{"SHA-256": newBytesAsset(goModData).SHA256()}},
+		{Name: aws.String("v0.1.0.zip"), Hashes: map[string]string{"SHA-256": newBytesAsset(zipData).SHA256()}},
+	}
+	status := codeartifactTypes.PackageVersionStatusPublished
+
+	var published, deleted, updated []string
+
+	repo.client = &MockCodeArtifactClient{
+		ListPackageVersionAssetsFunc: func(
+			ctx context.Context,
+			params *codeartifact.ListPackageVersionAssetsInput,
+			optFns ...func(*codeartifact.Options),
+		) (*codeartifact.ListPackageVersionAssetsOutput, error) {
+			return &codeartifact.ListPackageVersionAssetsOutput{Assets: assets}, nil
+		},
+		DescribePackageVersionFunc: func(
+			ctx context.Context,
+			params *codeartifact.DescribePackageVersionInput,
+			optFns ...func(*codeartifact.Options),
+		) (*codeartifact.DescribePackageVersionOutput, error) {
+			return &codeartifact.DescribePackageVersionOutput{
+				PackageVersion: &codeartifactTypes.PackageVersionDescription{Status: status},
+			}, nil
+		},
+		PublishPackageVersionFunc: func(
+			ctx context.Context,
+			params *codeartifact.PublishPackageVersionInput,
+			optFns ...func(*codeartifact.Options),
+		) (*codeartifact.PublishPackageVersionOutput, error) {
+			published = append(published, fmt.Sprintf("%v:%v", aws.ToString(params.AssetName), aws.ToBool(params.Unfinished)))
+			return &codeartifact.PublishPackageVersionOutput{}, nil
+		},
+		DeletePackageVersionsFunc: func(
+			ctx context.Context,
+			params *codeartifact.DeletePackageVersionsInput,
+			optFns ...func(*codeartifact.Options),
+		) (*codeartifact.DeletePackageVersionsOutput, error) {
+			deleted = append(deleted, params.Versions...)
+			return &codeartifact.DeletePackageVersionsOutput{}, nil
+		},
+		UpdatePackageVersionsStatusFunc: func(
+			ctx context.Context,
+			params *codeartifact.UpdatePackageVersionsStatusInput,
+			optFns ...func(*codeartifact.Options),
+		) (*codeartifact.UpdatePackageVersionsStatusOutput, error) {
+			updated = append(updated, params.Versions...)
+			return &codeartifact.UpdatePackageVersionsStatusOutput{}, nil
+		},
+	}
+
+	put := func(zipData []byte, opts PutOptions) error {
+		published, deleted, updated = nil, nil, nil
+		return repo.Put(context.Background(), "github.com/go-goxm/ca_module1", "v0.1.0", newBytesAsset(goModData), newBytesAsset(infoData), newBytesAsset(zipData), newBytesAsset(hashesData), nil, opts)
+	}
+
+	// Publishing identical content succeeds without publishing again
+	err := put(zipData, PutOptions{})
+	require.Nil(t, err, err)
+	require.Empty(t, published)
+
+	err = put([]byte("changed"), PutOptions{})
+	require.ErrorContains(t, err, "Version already published with different content: github.com/go-goxm/ca_module1@v0.1.0: v0.1.0.zip")
+	require.Empty(t, published)
+
+	// Published versions are only replaced if forced
+	err = put([]byte("changed"), PutOptions{Discard: true})
+	require.ErrorContains(t, err, "Version already published with different content")
+
+	err = put([]byte("changed"), PutOptions{Force: true})
+	require.Nil(t, err, err)
+	require.Equal(t, []string{"v0.1.0"}, deleted)
+	require.Equal(t, []string{"v0.1.0.hashes:true", "v0.1.0.info:true", "v0.1.0.mod:true", "v0.1.0.zip:false"}, published)
+
+	// Interrupted publishes are reported until resumed or discarded
+	assets = assets[:3]
+	status = codeartifactTypes.PackageVersionStatusUnfinished
+
+	err = put(zipData, PutOptions{})
+	require.ErrorContains(t, err, "Version partially published by an interrupted publish: github.com/go-goxm/ca_module1@v0.1.0: v0.1.0.hashes, v0.1.0.info, v0.1.0.mod (use --resume")
+	require.Empty(t, published)
+
+	err = put(zipData, PutOptions{Resume: true})
+	require.Nil(t, err, err)
+	require.Empty(t, deleted)
+	require.Equal(t, []string{"v0.1.0.zip:false"}, published)
+
+	err = put(zipData, PutOptions{Discard: true})
+	require.Nil(t, err, err)
+	require.Equal(t, []string{"v0.1.0"}, deleted)
+	require.Equal(t, []string{"v0.1.0.hashes:true", "v0.1.0.info:true", "v0.1.0.mod:true", "v0.1.0.zip:false"}, published)
+
+	// Unfinished versions with different content can not be resumed
+	err = put(zipData, PutOptions{Resume: true})
+	require.Nil(t, err, err)
+
+	goModData = []byte("module github.com/go-goxm/changed\n")
+	err = put(zipData, PutOptions{Resume: true})
+	require.ErrorContains(t, err, "Version partially published with different content: github.com/go-goxm/ca_module1@v0.1.0: v0.1.0.mod (use --discard")
+	require.Empty(t, published)
+
+	// Unfinished versions with all of the assets are published
+	goModData = []byte("module github.com/go-goxm/ca_module1\n")
+	assets = append(assets, codeartifactTypes.AssetSummary{
+		Name:   aws.String("v0.1.0.zip"),
+		Hashes: map[string]string{"SHA-256": newBytesAsset(zipData).SHA256()},
+	})
+
+	err = put(zipData, PutOptions{})
+	require.ErrorContains(t, err, "Version partially published by an interrupted publish")
+
+	err = put(zipData, PutOptions{Resume: true})
+	require.Nil(t, err, err)
+	require.Empty(t, published)
+	require.Equal(t, []string{"v0.1.0"}, updated)
+
+	// Versions published before hashes were published are complete
+	assets = assets[1:]
+	status = codeartifactTypes.PackageVersionStatusPublished
+
+	err = put(zipData, PutOptions{})
+	require.Nil(t, err, err)
+	require.Empty(t, published)
+}
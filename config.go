@@ -6,22 +6,74 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+
+	"golang.org/x/mod/module"
 )
 
 type RawConfig struct {
 	Repos map[string]json.RawMessage `json:"repos"`
+	Cache *CacheConfig               `json:"cache"`
+	SumDB *SumDBConfig               `json:"sumdb"`
 }
 
 type Repository interface {
 	Get(ctx context.Context, module, attifact string) (io.ReadCloser, int, error)
-	Put(ctx context.Context, module, version string, goModData, goInfoData, goZipData []byte) error
+
+	// Put publishes the assets of a version. The signature
+	// asset (goSig) is nil if the version is not signed.
+	Put(ctx context.Context, module, version string, goMod, goInfo, goZip, goHashes, goSig Asset, opts PutOptions) error
+}
+
+// Asset is the content of a module asset to publish, with the size and
+// SHA-256 hash computed in advance. The content is opened for each read
+// so that large assets, like module zip files, are not held in memory.
+type Asset interface {
+	Open() (io.ReadSeekCloser, error)
+	Size() int64
+	SHA256() string
+}
+
+type PutOptions struct {
+	// Force overwrites a version that is already published
+	// instead of failing if the content is different
+	Force bool
+
+	// Resume finishes publishing a version left
+	// partially published by an interrupted publish
+	Resume bool
+
+	// Discard deletes a version left partially published
+	// by an interrupted publish and publishes it again
+	Discard bool
 }
 
 type Config struct {
 	Repos map[string]Repository
+	Cache *Cache
+
+	// SumDB records the hashes of published modules, if configured
+	SumDB *SumDB
+
+	// Signatures of the repositories that sign or verify
+	// versions, keyed by the module patterns of the repository
+	Signatures map[string]*Signatures
+
+	// Offline serves assets only from the cache
+	Offline bool
+
+	// Module patterns ordered from most to least specific
+	patterns []*repoPattern
+}
+
+type repoPattern struct {
+	moduleGlobs string
+	glob        string
+	repository  Repository
 }
 
 type RepoTypeConfig struct {
@@ -30,8 +82,48 @@ type RepoTypeConfig struct {
 
 const defaultConfigName = ".goxm.json"
 
+// The user config directory and the directory the search for `.goxm.json`
+// files stops at (if not empty) are variables so that tests can isolate
+// the config they load from the environment running the tests
+var (
+	userConfigDir    = os.UserConfigDir
+	configCeilingDir string
+)
+
+// LoadDefaultConfig merges the user config file, the `.goxm.json` files from
+// the root to the current directory and the GOXM_CONFIG file, in that order
 func LoadDefaultConfig() (*Config, error) {
-	var err error
+	configPaths, err := defaultConfigPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []*Config
+	for _, configPath := range configPaths {
+		config, err := loadConfigFile(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading default config: %v: %w", configPath, err)
+		}
+		configs = append(configs, config)
+	}
+
+	return mergeConfigs(configs)
+}
+
+// defaultConfigPaths returns the paths of the existing
+// configuration files ordered from lowest to highest precedence
+func defaultConfigPaths() ([]string, error) {
+	var configPaths []string
+
+	configDir, err := userConfigDir()
+	if err == nil {
+		userConfigPath := filepath.Join(configDir, "goxm", "config.json")
+		if _, err := os.Stat(userConfigPath); err == nil {
+			configPaths = append(configPaths, userConfigPath)
+		}
+	}
+
+	var projectConfigPaths []string
 	var configPath string
 	var prevConfigPath string
 
@@ -39,39 +131,124 @@ func LoadDefaultConfig() (*Config, error) {
 		prevConfigPath = configPath
 		configPath, err = filepath.Abs(cp)
 		if err != nil || prevConfigPath == configPath {
-			return nil, fmt.Errorf("Config file not found: %v", defaultConfigName)
+			break
 		}
 
-		configFile, err := os.Open(configPath)
-		if err != nil {
-			continue
+		if _, err := os.Stat(configPath); err == nil {
+			projectConfigPaths = append(projectConfigPaths, configPath)
 		}
 
-		config, err := LoadConfig(configFile)
-		if err != nil {
-			return nil, fmt.Errorf("Error loading default config: %v: %w", configPath, err)
+		if filepath.Dir(configPath) == configCeilingDir {
+			break
+		}
+	}
+
+	// Files nearer to the current directory take precedence
+	for i := len(projectConfigPaths) - 1; i >= 0; i-- {
+		configPaths = append(configPaths, projectConfigPaths[i])
+	}
+
+	if envConfigPath := os.Getenv("GOXM_CONFIG"); envConfigPath != "" {
+		if _, err := os.Stat(envConfigPath); err != nil {
+			return nil, fmt.Errorf("Config file not found: GOXM_CONFIG=%v", envConfigPath)
 		}
-		return config, nil
+		configPaths = append(configPaths, envConfigPath)
 	}
+
+	if len(configPaths) == 0 {
+		return nil, fmt.Errorf("Config file not found: %v", defaultConfigName)
+	}
+	return configPaths, nil
+}
+
+func loadConfigFile(configPath string) (*Config, error) {
+	configPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	configFile, err := os.Open(configPath)
+	if err != nil {
+		return nil, err
+	}
+	defer configFile.Close()
+
+	return loadConfig(configFile, filepath.Dir(configPath))
+}
+
+// mergeConfigs merges the configurations ordered from lowest to highest
+// precedence. Repositories are merged by module pattern, and the other
+// sections are replaced as a whole by a configuration with higher precedence.
+func mergeConfigs(configs []*Config) (*Config, error) {
+	repos := map[string]Repository{}
+	signatures := map[string]*Signatures{}
+	var cache *Cache
+	var sumDB *SumDB
+
+	for _, config := range configs {
+		for moduleGlobs, repository := range config.Repos {
+			repos[moduleGlobs] = repository
+			delete(signatures, moduleGlobs)
+			if config.Signatures[moduleGlobs] != nil {
+				signatures[moduleGlobs] = config.Signatures[moduleGlobs]
+			}
+		}
+		if config.Cache != nil {
+			cache = config.Cache
+		}
+		if config.SumDB != nil {
+			sumDB = config.SumDB
+		}
+	}
+
+	merged, err := newConfig(repos)
+	if err != nil {
+		return nil, err
+	}
+	merged.Signatures = signatures
+	merged.Cache = cache
+	merged.SumDB = sumDB
+
+	return merged, nil
 }
 
 func LoadConfig(configReader io.Reader) (*Config, error) {
+	return loadConfig(configReader, "")
+}
+
+// loadConfig reads the config and resolves relative
+// file system paths against the base directory
+func loadConfig(configReader io.Reader, baseDir string) (*Config, error) {
 	config := &Config{
 		Repos: map[string]Repository{},
 	}
+	signatures := map[string]*Signatures{}
+
+	var value any
+	decoder := json.NewDecoder(configReader)
+	decoder.UseNumber()
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading file: %w", err)
+	}
+
+	value, err = interpolateConfig(value)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing config: %w", err)
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading file: %w", err)
+	}
 
 	var rawConfig *RawConfig
-	err := json.NewDecoder(configReader).Decode(&rawConfig)
+	err = json.Unmarshal(data, &rawConfig)
 	if err != nil {
 		return nil, fmt.Errorf("Error reading file: %w", err)
 	}
 
 	for moduleGlob, rawRepoConfig := range rawConfig.Repos {
-		_, err = regexp.Compile(globToRegexp(moduleGlob))
-		if err != nil {
-			return nil, fmt.Errorf("Malformed module glob: %v: %w", moduleGlob, err)
-		}
-
 		var repoTypeConfig *RepoTypeConfig
 		err = json.Unmarshal(rawRepoConfig, &repoTypeConfig)
 		if err != nil {
@@ -87,14 +264,194 @@ func LoadConfig(configReader io.Reader) (*Config, error) {
 			}
 			config.Repos[moduleGlob] = codeArtifactRepoConfig
 
+		case "s3":
+			var s3RepoConfig *S3RepoConfig
+			err = json.Unmarshal(rawRepoConfig, &s3RepoConfig)
+			if err != nil {
+				return nil, fmt.Errorf("Error parsing repo config: %v: %w", repoTypeConfig.Type, err)
+			}
+			if s3RepoConfig.Bucket == nil {
+				return nil, fmt.Errorf("Repository bucket not specified: %v", moduleGlob)
+			}
+			config.Repos[moduleGlob] = s3RepoConfig
+
+		case "goproxy":
+			var goProxyRepoConfig *GoProxyRepoConfig
+			err = json.Unmarshal(rawRepoConfig, &goProxyRepoConfig)
+			if err != nil {
+				return nil, fmt.Errorf("Error parsing repo config: %v: %w", repoTypeConfig.Type, err)
+			}
+			if goProxyRepoConfig.URL == "" {
+				return nil, fmt.Errorf("Repository URL not specified: %v", moduleGlob)
+			}
+			goProxyRepoConfig.client, err = goProxyRepoConfig.newClient()
+			if err != nil {
+				return nil, fmt.Errorf("Error parsing repo config: %v: %w", moduleGlob, err)
+			}
+			config.Repos[moduleGlob] = goProxyRepoConfig
+
+		case "filesystem":
+			var fileSystemRepoConfig *FileSystemRepoConfig
+			err = json.Unmarshal(rawRepoConfig, &fileSystemRepoConfig)
+			if err != nil {
+				return nil, fmt.Errorf("Error parsing repo config: %v: %w", repoTypeConfig.Type, err)
+			}
+			if fileSystemRepoConfig.Path == "" {
+				return nil, fmt.Errorf("Repository path not specified: %v", moduleGlob)
+			}
+			if !filepath.IsAbs(fileSystemRepoConfig.Path) {
+				fileSystemRepoConfig.Path = filepath.Join(baseDir, fileSystemRepoConfig.Path)
+			}
+			config.Repos[moduleGlob] = fileSystemRepoConfig
+
 		default:
 			return nil, fmt.Errorf("Repository type not supported: %v", repoTypeConfig.Type)
 		}
+
+		var signatureConfig *SignatureConfig
+		err = json.Unmarshal(rawRepoConfig, &signatureConfig)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing repo config: %v: %w", moduleGlob, err)
+		}
+		if signatureConfig.SignerKeyFile != "" || signatureConfig.VerifySignatures || len(signatureConfig.VerifierKeys) > 0 {
+			signatures[moduleGlob], err = newSignatures(signatureConfig, baseDir)
+			if err != nil {
+				return nil, fmt.Errorf("Error parsing repo config: %v: %w", moduleGlob, err)
+			}
+		}
+	}
+
+	config, err = newConfig(config.Repos)
+	if err != nil {
+		return nil, err
+	}
+	config.Signatures = signatures
+
+	if rawConfig.Cache != nil {
+		config.Cache, err = newCache(rawConfig.Cache, baseDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if rawConfig.SumDB != nil {
+		config.SumDB, err = newSumDB(rawConfig.SumDB, baseDir)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return config, nil
 }
 
-func globToRegexp(glob string) string {
-	return strings.ReplaceAll(regexp.QuoteMeta(glob), "\\*", "(.*)")
+var envVarPattern = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}`)
+
+// interpolateConfig replaces `${VAR}` and `${VAR:-default}` in the string values
+// of the decoded config with the environment variable, and `$${` with `${`
+func interpolateConfig(value any) (any, error) {
+	switch value := value.(type) {
+	case string:
+		var err error
+		expanded := envVarPattern.ReplaceAllStringFunc(value, func(match string) string {
+			if match == "$${" {
+				return "${"
+			}
+			submatches := envVarPattern.FindStringSubmatch(match)
+			envValue, ok := os.LookupEnv(submatches[1])
+			if defaultValue, hasDefault := strings.CutPrefix(submatches[2], ":-"); hasDefault {
+				if envValue == "" {
+					return defaultValue
+				}
+			} else if !ok && err == nil {
+				err = fmt.Errorf("Environment variable not set: %v", submatches[1])
+			}
+			return envValue
+		})
+		return expanded, err
+
+	case map[string]any:
+		for key, item := range value {
+			expanded, err := interpolateConfig(item)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %w", key, err)
+			}
+			value[key] = expanded
+		}
+
+	case []any:
+		for i, item := range value {
+			expanded, err := interpolateConfig(item)
+			if err != nil {
+				return nil, err
+			}
+			value[i] = expanded
+		}
+	}
+	return value, nil
+}
+
+// newConfig splits the GOPRIVATE style module patterns of the repositories
+// and orders them so that the most specific pattern is matched first
+func newConfig(repos map[string]Repository) (*Config, error) {
+	config := &Config{
+		Repos: repos,
+	}
+
+	for moduleGlobs, repository := range repos {
+		for _, glob := range strings.Split(moduleGlobs, ",") {
+			glob = strings.Trim(strings.TrimSpace(glob), "/")
+			if glob == "" {
+				continue
+			}
+
+			_, err := path.Match(glob, "")
+			if err != nil {
+				return nil, fmt.Errorf("Malformed module glob: %v: %w", moduleGlobs, err)
+			}
+
+			config.patterns = append(config.patterns, &repoPattern{
+				moduleGlobs: moduleGlobs,
+				glob:        glob,
+				repository:  repository,
+			})
+		}
+	}
+
+	sort.Slice(config.patterns, func(i, j int) bool {
+		return compareGlobSpecificity(config.patterns[i].glob, config.patterns[j].glob) > 0
+	})
+
+	return config, nil
+}
+
+// findRepository returns the repository with the most
+// specific module pattern matching the module path
+func (c *Config) findRepository(modPath string) (string, Repository, bool) {
+	for _, pattern := range c.patterns {
+		if module.MatchPrefixPatterns(pattern.glob, modPath) {
+			return pattern.moduleGlobs, pattern.repository, true
+		}
+	}
+	return "", nil, false
+}
+
+// compareGlobSpecificity orders module patterns by the number of path elements,
+// then by the number of literal characters, then by the number of wildcards,
+// and then lexically as a tie breaker
+func compareGlobSpecificity(a, b string) int {
+	if aElems, bElems := strings.Count(a, "/"), strings.Count(b, "/"); aElems != bElems {
+		return aElems - bElems
+	}
+	aWildcards, bWildcards := countGlobWildcards(a), countGlobWildcards(b)
+	if aLiterals, bLiterals := len(a)-aWildcards, len(b)-bWildcards; aLiterals != bLiterals {
+		return aLiterals - bLiterals
+	}
+	if aWildcards != bWildcards {
+		return bWildcards - aWildcards
+	}
+	return strings.Compare(b, a)
+}
+
+func countGlobWildcards(glob string) int {
+	return strings.Count(glob, "*") + strings.Count(glob, "?") + strings.Count(glob, "[")
 }
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindRepository(t *testing.T) {
+	config, err := LoadConfig(strings.NewReader(`{
+		"repos": {
+			"github.com/acme/*": {"type": "filesystem", "path": "/repo1"},
+			"github.com/acme/tools": {"type": "filesystem", "path": "/repo2"},
+			"github.com/*/tools": {"type": "filesystem", "path": "/repo3"},
+			"gitlab.com/acme,example.com/acme/lib": {"type": "filesystem", "path": "/repo4"}
+		}
+	}`))
+	require.Nilf(t, err, "Error loading config: %v", err)
+
+	expectedGlobs := map[string]string{
+		"github.com/acme/tools":        "github.com/acme/tools",
+		"github.com/acme/tools/v2":     "github.com/acme/tools",
+		"github.com/acme/toolsx":       "github.com/acme/*",
+		"github.com/acme/lib":          "github.com/acme/*",
+		"github.com/acme/lib/sub":      "github.com/acme/*",
+		"github.com/example/tools":     "github.com/*/tools",
+		"github.com/example/tools/sub": "github.com/*/tools",
+		"github.com/example/lib/tools": "",
+		"github.com/acme":              "",
+		"evil.com/github.com/acme/lib": "",
+		"gitlab.com/acme/library":      "gitlab.com/acme,example.com/acme/lib",
+		"example.com/acme/lib/v2":      "gitlab.com/acme,example.com/acme/lib",
+		"example.com/acme/library":     "",
+		"gitlab.com/example/library":   "",
+	}
+
+	// Matching must not depend on map iteration order
+	for i := 0; i < 20; i++ {
+		for modPath, expectedGlob := range expectedGlobs {
+			glob, repository, ok := config.findRepository(modPath)
+			require.Equal(t, expectedGlob, glob, modPath)
+			require.Equal(t, expectedGlob != "", ok, modPath)
+			if ok {
+				require.Same(t, config.Repos[expectedGlob], repository, modPath)
+			}
+		}
+	}
+
+	_, err = LoadConfig(strings.NewReader(`{"repos": {"github.com/[acme/*": {"type": "filesystem", "path": "/repo1"}}}`))
+	require.Error(t, err)
+}
+
+func TestLoadDefaultConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig := func(configPath, content string) string {
+		err := os.MkdirAll(filepath.Dir(configPath), 0o755)
+		require.Nil(t, err, err)
+		err = os.WriteFile(configPath, []byte(content), 0o644)
+		require.Nil(t, err, err)
+		return configPath
+	}
+
+	userDir := isolateConfig(t, dir)
+	chdir(t, dir)
+
+	_, err := LoadDefaultConfig()
+	require.ErrorContains(t, err, "Config file not found")
+
+	writeConfig(filepath.Join(userDir, "goxm", "config.json"), `{
+		"cache": {"dir": "/var/cache/goxm"},
+		"repos": {
+			"github.com/acme/*": {"type": "codeartifact", "repository": "acme", "domain": "acme", "domain_owner": "111111111111"},
+			"github.com/acme/tools": {"type": "filesystem", "path": "user", "signer_key_file": "tools.key"}
+		}
+	}`)
+	writeConfig(filepath.Join(dir, "project", defaultConfigName), `{
+		"repos": {
+			"github.com/acme/tools": {"type": "filesystem", "path": "tools"},
+			"github.com/example/*": {"type": "filesystem", "path": "example"}
+		}
+	}`)
+	writeConfig(filepath.Join(dir, "project", "module", defaultConfigName), `{
+		"repos": {
+			"github.com/example/*": {"type": "filesystem", "path": "module"}
+		}
+	}`)
+	chdir(t, filepath.Join(dir, "project", "module"))
+
+	config, err := LoadDefaultConfig()
+	require.Nil(t, err, err)
+
+	require.Len(t, config.Repos, 3)
+	require.IsType(t, &CodeArtifactRepoConfig{}, config.Repos["github.com/acme/*"])
+	require.Equal(t, filepath.Join(dir, "project", "tools"), config.Repos["github.com/acme/tools"].(*FileSystemRepoConfig).Path)
+	require.Equal(t, filepath.Join(dir, "project", "module", "module"), config.Repos["github.com/example/*"].(*FileSystemRepoConfig).Path)
+	require.Nil(t, config.Signatures["github.com/acme/tools"])
+	require.Equal(t, "/var/cache/goxm", config.Cache.Dir)
+
+	glob, _, ok := config.findRepository("github.com/acme/tools/v2")
+	require.True(t, ok)
+	require.Equal(t, "github.com/acme/tools", glob)
+
+	t.Setenv("GOXM_CONFIG", writeConfig(filepath.Join(dir, "goxm.json"), `{
+		"cache": {"dir": "cache"},
+		"repos": {
+			"github.com/example/*": {"type": "filesystem", "path": "env"}
+		}
+	}`))
+
+	config, err = LoadDefaultConfig()
+	require.Nil(t, err, err)
+	require.Equal(t, filepath.Join(dir, "env"), config.Repos["github.com/example/*"].(*FileSystemRepoConfig).Path)
+	require.Equal(t, filepath.Join(dir, "cache"), config.Cache.Dir)
+
+	t.Setenv("GOXM_CONFIG", filepath.Join(dir, "missing.json"))
+	_, err = LoadDefaultConfig()
+	require.ErrorContains(t, err, "Config file not found: GOXM_CONFIG=")
+}
+
+func TestConfigInterpolation(t *testing.T) {
+	t.Setenv("GOXM_TEST_STAGE", "prod")
+	t.Setenv("GOXM_TEST_DOMAIN_OWNER", "222222222222")
+	t.Setenv("GOXM_TEST_EMPTY", "")
+
+	config, err := LoadConfig(strings.NewReader(`{
+		"repos": {
+			"github.com/acme/*": {
+				"type": "codeartifact",
+				"domain": "acme-${GOXM_TEST_STAGE}",
+				"domain_owner": "${GOXM_TEST_DOMAIN_OWNER}",
+				"repository": "${GOXM_TEST_REPOSITORY:-modules}",
+				"namespace": "${GOXM_TEST_EMPTY:-acme}"
+			},
+			"github.com/example/*": {"type": "s3", "bucket": "$HOME-${GOXM_TEST_EMPTY}", "endpoint": "${GOXM_TEST_ENDPOINT:-}", "prefix": "$${GOXM_TEST_STAGE}/${GOXM_TEST_STAGE}"}
+		}
+	}`))
+	require.Nil(t, err, err)
+
+	repoConfig := config.Repos["github.com/acme/*"].(*CodeArtifactRepoConfig)
+	require.Equal(t, "acme-prod", *repoConfig.Domain)
+	require.Equal(t, "222222222222", *repoConfig.DomainOwner)
+	require.Equal(t, "modules", *repoConfig.Repository)
+	require.Equal(t, "acme", *repoConfig.Namespace)
+
+	s3Config := config.Repos["github.com/example/*"].(*S3RepoConfig)
+	require.Equal(t, "$HOME-", *s3Config.Bucket)
+	require.Equal(t, "", s3Config.Endpoint)
+	require.Equal(t, "${GOXM_TEST_STAGE}/prod", s3Config.Prefix)
+
+	_, err = LoadConfig(strings.NewReader(`{
+		"repos": {
+			"github.com/acme/*": {"type": "codeartifact", "domain": "acme", "domain_owner": "${GOXM_TEST_UNSET}", "repository": "modules"}
+		}
+	}`))
+	require.ErrorContains(t, err, "repos: github.com/acme/*: domain_owner: Environment variable not set: GOXM_TEST_UNSET")
+}
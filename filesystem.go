@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/mod/module"
+)
+
+type FileSystemRepoConfig struct {
+	RepoTypeConfig
+	Path string `json:"path"`
+}
+
+func (r *FileSystemRepoConfig) Get(ctx context.Context, module, attifact string) (io.ReadCloser, int, error) {
+	modDir, err := r.moduleDir(module)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if attifact == "@latest" || attifact == "@v/list" {
+		file, err := os.Open(filepath.Join(modDir, filepath.FromSlash(attifact)))
+		if err != nil {
+			return nil, http.StatusNotFound, fmt.Errorf("Error reading file system asset: %v/%v: %w", module, attifact, err)
+		}
+		logf("Got file system asset: %v", file.Name())
+		return file, 0, nil
+	}
+
+	asset, ok := strings.CutPrefix(attifact, "@v/")
+	if !ok || strings.ContainsAny(asset, "/\\") {
+		return nil, http.StatusBadRequest, fmt.Errorf("Asset path not supported: %v/%v", module, attifact)
+	}
+
+	if !slices.Contains(assetExtensions, path.Ext(asset)) {
+		return nil, http.StatusForbidden, fmt.Errorf("Asset extension not supported: %v/%v", module, attifact)
+	}
+
+	file, err := os.Open(filepath.Join(modDir, "@v", asset))
+	if err != nil {
+		return nil, http.StatusForbidden, fmt.Errorf("Error reading file system asset: %v/%v: %w", module, attifact, err)
+	}
+	logf("Got file system asset: %v", file.Name())
+
+	return file, 0, nil
+}
+
+func (r *FileSystemRepoConfig) Put(ctx context.Context, modPath, version string, goMod, info, zip, hashes, sig Asset, opts PutOptions) error {
+
+	modDir, err := r.moduleDir(modPath)
+	if err != nil {
+		return err
+	}
+
+	return putProxyTree(fileSystemTree(modDir), modPath, version, goMod, info, zip, hashes, sig, opts)
+}
+
+// fileSystemTree is the directory of a module in a file system repository
+type fileSystemTree string
+
+func (t fileSystemTree) sha256(name string) (string, bool, error) {
+	filePath := filepath.Join(string(t), filepath.FromSlash(name))
+	hash, err := fileSHA256(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, fmt.Errorf("Error reading file system asset: %v: %w", filePath, err)
+	}
+	return hash, true, nil
+}
+
+func (t fileSystemTree) read(name string) ([]byte, bool, error) {
+	filePath := filepath.Join(string(t), filepath.FromSlash(name))
+	data, err := os.ReadFile(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, fmt.Errorf("Error reading file system asset: %v: %w", filePath, err)
+	}
+	return data, true, nil
+}
+
+func (t fileSystemTree) write(name string, asset Asset) error {
+	filePath := filepath.Join(string(t), filepath.FromSlash(name))
+	err := os.MkdirAll(filepath.Dir(filePath), 0o755)
+	if err != nil {
+		return fmt.Errorf("Error creating file system repository directory: %w", err)
+	}
+
+	err = writeAsset(filePath, asset)
+	if err != nil {
+		return fmt.Errorf("Error publishing file system asset: %v: %w", filePath, err)
+	}
+	logf("Published file system asset: %v", filePath)
+
+	return nil
+}
+
+func (t fileSystemTree) remove(name string) error {
+	filePath := filepath.Join(string(t), filepath.FromSlash(name))
+	err := os.Remove(filePath)
+	if err != nil {
+		return fmt.Errorf("Error removing file system asset: %v: %w", filePath, err)
+	}
+	logf("Removed file system asset: %v", filePath)
+
+	return nil
+}
+
+func (t fileSystemTree) forbidden(err error) bool {
+	return false
+}
+
+func fileSHA256(name string) (string, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	return hashReader(file)
+}
+
+func writeAsset(name string, asset Asset) error {
+	reader, err := asset.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return writeReaderAtomic(name, reader)
+}
+
+func (r *FileSystemRepoConfig) moduleDir(modPath string) (string, error) {
+	if r.Path == "" {
+		return "", fmt.Errorf("File system repository path not configured")
+	}
+
+	escapedPath, err := module.EscapePath(modPath)
+	if err != nil {
+		return "", fmt.Errorf("Error escaping module path: %v: %w", modPath, err)
+	}
+
+	return filepath.Join(r.Path, filepath.FromSlash(escapedPath)), nil
+}
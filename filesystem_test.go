@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSystemPutGet(t *testing.T) {
+	repo := &FileSystemRepoConfig{Path: t.TempDir()}
+
+	goModData := readFile(t, "./testdata/ca_module1_assets/v0.1.0.mod")
+	infoData := readFile(t, "./testdata/ca_module1_assets/v0.1.0.info")
+	zipData := readFile(t, "./testdata/ca_module1_assets/v0.1.0.zip")
+
+	goMod, info, zip := newBytesAsset(goModData), newBytesAsset(infoData), newBytesAsset(zipData)
+	hashes := newTestAssetHashes(t, "github.com/go-goxm/Module1", "v0.1.0", goModData, infoData, zipData)
+
+	err := repo.Put(context.Background(), "github.com/go-goxm/Module1", "v0.1.0", goMod, info, zip, hashes, nil, PutOptions{})
+	require.Nil(t, err, err)
+
+	// Publishing the same version again must not duplicate the list entry
+	err = repo.Put(context.Background(), "github.com/go-goxm/Module1", "v0.1.0", goMod, info, zip, hashes, nil, PutOptions{})
+	require.Nil(t, err, err)
+
+	err = repo.Put(context.Background(), "github.com/go-goxm/Module1", "v0.2.0", goMod, info, zip, hashes, nil, PutOptions{})
+	require.Nil(t, err, err)
+
+	// Publishing different content for the same version must fail unless forced
+	err = repo.Put(context.Background(), "github.com/go-goxm/Module1", "v0.2.0", goMod, info, newBytesAsset([]byte("changed")), hashes, nil, PutOptions{})
+	require.ErrorContains(t, err, "Version already published with different content: github.com/go-goxm/Module1@v0.2.0: v0.2.0.zip")
+
+	err = repo.Put(context.Background(), "github.com/go-goxm/Module1", "v0.2.0", goMod, info, newBytesAsset([]byte("changed")), hashes, nil, PutOptions{Force: true})
+	require.Nil(t, err, err)
+	require.Equal(t, []byte("changed"), readFile(t, filepath.Join(repo.Path, "github.com/go-goxm/!module1/@v/v0.2.0.zip")))
+
+	err = repo.Put(context.Background(), "github.com/go-goxm/Module1", "v0.2.0", goMod, info, zip, hashes, nil, PutOptions{Force: true})
+	require.Nil(t, err, err)
+
+	// Interrupted publishes must be resumed or discarded
+	require.Nil(t, os.Remove(filepath.Join(repo.Path, "github.com/go-goxm/!module1/@v/v0.2.0.zip")))
+
+	err = repo.Put(context.Background(), "github.com/go-goxm/Module1", "v0.2.0", goMod, info, zip, hashes, nil, PutOptions{})
+	require.ErrorContains(t, err, "Version partially published by an interrupted publish: github.com/go-goxm/Module1@v0.2.0: v0.2.0.hashes, v0.2.0.info, v0.2.0.mod")
+
+	err = repo.Put(context.Background(), "github.com/go-goxm/Module1", "v0.2.0", goMod, info, zip, hashes, nil, PutOptions{Resume: true})
+	require.Nil(t, err, err)
+
+	// Versions published before hashes were published are complete
+	require.Nil(t, os.Remove(filepath.Join(repo.Path, "github.com/go-goxm/!module1/@v/v0.2.0.hashes")))
+
+	err = repo.Put(context.Background(), "github.com/go-goxm/Module1", "v0.2.0", goMod, info, zip, hashes, nil, PutOptions{})
+	require.Nil(t, err, err)
+
+	// Module paths are stored using the GOPROXY case escaping
+	require.FileExists(t, filepath.Join(repo.Path, "github.com/go-goxm/!module1/@v/v0.1.0.zip"))
+
+	expectedAssets := map[string][]byte{
+		"@v/list":        []byte("v0.1.0\nv0.2.0\n"),
+		"@v/v0.1.0.info": infoData,
+		"@v/v0.1.0.mod":  goModData,
+		"@v/v0.1.0.zip":  zipData,
+	}
+
+	for attifact, expected := range expectedAssets {
+		reader, _, err := repo.Get(context.Background(), "github.com/go-goxm/Module1", attifact)
+		require.Nil(t, err, err)
+
+		data, err := io.ReadAll(reader)
+		require.Nil(t, err)
+		require.Nil(t, reader.Close())
+		require.Equal(t, expected, data, attifact)
+	}
+
+	_, status, err := repo.Get(context.Background(), "github.com/go-goxm/Module1", "@latest")
+	require.Error(t, err)
+	require.Equal(t, http.StatusNotFound, status)
+
+	_, status, err = repo.Get(context.Background(), "github.com/go-goxm/Module1", "@v/v0.3.0.zip")
+	require.Error(t, err)
+	require.Equal(t, http.StatusForbidden, status)
+
+	_, status, err = repo.Get(context.Background(), "github.com/go-goxm/Module1", "@v/../../../list")
+	require.Error(t, err)
+	require.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestFileSystemConfig(t *testing.T) {
+	configDir := t.TempDir()
+	configPath := filepath.Join(configDir, defaultConfigName)
+	isolateConfig(t, configDir)
+
+	err := os.WriteFile(configPath, []byte(`{
+		"repos": {
+			"github.com/go-goxm/*": {
+				"type": "filesystem",
+				"path": "repo"
+			}
+		}
+	}`), 0o644)
+	require.Nil(t, err)
+
+	chdir(t, configDir)
+
+	config, err := LoadDefaultConfig()
+	require.Nilf(t, err, "Error loading default config: %v", err)
+
+	repo := config.Repos["github.com/go-goxm/*"].(*FileSystemRepoConfig)
+	require.Equal(t, filepath.Join(configDir, "repo"), repo.Path)
+
+	_, err = LoadConfig(strings.NewReader(`{"repos": {"github.com/go-goxm/*": {"type": "filesystem"}}}`))
+	require.Error(t, err)
+}
+
+func TestFileSystemBuild(t *testing.T) {
+	// Cache is created with read-write permissions
+	// to avoid error on temp directory cleanup
+	t.Setenv("GOFLAGS", "-modcacherw")
+	t.Setenv("GOMODCACHE", t.TempDir())
+
+	repo := &FileSystemRepoConfig{Path: t.TempDir()}
+
+	err := repo.Put(
+		context.Background(),
+		"github.com/go-goxm/ca_module1",
+		"v0.1.0",
+		newBytesAsset(readFile(t, "./testdata/ca_module1_assets/v0.1.0.mod")),
+		newBytesAsset(readFile(t, "./testdata/ca_module1_assets/v0.1.0.info")),
+		newBytesAsset(readFile(t, "./testdata/ca_module1_assets/v0.1.0.zip")),
+		newTestAssetHashes(t,
+			"github.com/go-goxm/ca_module1",
+			"v0.1.0",
+			readFile(t, "./testdata/ca_module1_assets/v0.1.0.mod"),
+			readFile(t, "./testdata/ca_module1_assets/v0.1.0.info"),
+			readFile(t, "./testdata/ca_module1_assets/v0.1.0.zip"),
+		),
+		nil,
+		PutOptions{},
+	)
+	require.Nil(t, err, err)
+
+	chdir(t, "./testdata/ca_module3")
+
+	config, err := newConfig(map[string]Repository{
+		"github.com/go-goxm/ca_module1": repo,
+	})
+	require.Nil(t, err, err)
+
+	buildOutputPath := t.TempDir() + "/ca_module3"
+	err = runWithConfig(context.Background(), config, []string{"build", "-o", buildOutputPath})
+	require.Nil(t, err, err)
+	require.FileExists(t, buildOutputPath)
+}
+
+func readFile(t *testing.T, p string) []byte {
+	b, err := os.ReadFile(p)
+	require.Nil(t, err)
+	return b
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/module"
+)
+
+type GoProxyRepoConfig struct {
+	RepoTypeConfig
+	URL      string            `json:"url"`
+	Username string            `json:"username"`
+	Password string            `json:"password"`
+	Token    string            `json:"token"`
+	Headers  map[string]string `json:"headers"`
+	Timeout  string            `json:"timeout"`
+
+	client *http.Client
+}
+
+const defaultGoProxyTimeout = time.Minute
+
+// newClient returns the HTTP client for the repository, with a timeout
+// so that an unresponsive server does not block the go command
+func (r *GoProxyRepoConfig) newClient() (*http.Client, error) {
+	timeout := defaultGoProxyTimeout
+	if r.Timeout != "" {
+		var err error
+		timeout, err = time.ParseDuration(r.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("Malformed repository timeout: %v: %w", r.Timeout, err)
+		}
+	}
+	return &http.Client{Timeout: timeout}, nil
+}
+
+func (r *GoProxyRepoConfig) Get(ctx context.Context, modPath, attifact string) (io.ReadCloser, int, error) {
+	escapedPath, err := module.EscapePath(modPath)
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("Error escaping module path: %v: %w", modPath, err)
+	}
+
+	url := strings.TrimSuffix(r.URL, "/") + "/" + escapedPath + "/" + attifact
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("Error creating GOPROXY request: %v: %w", url, err)
+	}
+
+	for name, value := range r.Headers {
+		req.Header.Set(name, value)
+	}
+
+	if r.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.Token)
+	} else if r.Username != "" || r.Password != "" {
+		req.SetBasicAuth(r.Username, r.Password)
+	}
+
+	client := r.client
+	if client == nil {
+		client = &http.Client{Timeout: defaultGoProxyTimeout}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("Error getting GOPROXY asset: %v: %w", url, err)
+		return nil, goProxyErrorStatus(attifact, err), err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		err = &goProxyStatusError{URL: url, StatusCode: resp.StatusCode, Status: resp.Status}
+		return nil, goProxyErrorStatus(attifact, err), err
+	}
+	logf("Got GOPROXY asset: %v", url)
+
+	return resp.Body, 0, nil
+}
+
+// goProxyErrorStatus returns `Not Found` for version queries the upstream
+// server has none of, so that Go continues with the next proxy
+func goProxyErrorStatus(attifact string, err error) int {
+	if attifact != "@latest" && attifact != "@v/list" {
+		return http.StatusForbidden
+	}
+	if isAssetNotFound(err) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadGateway
+}
+
+// goProxyStatusError is returned for unsuccessful GOPROXY responses
+type goProxyStatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *goProxyStatusError) Error() string {
+	return fmt.Sprintf("Error getting GOPROXY asset: %v: %v", e.URL, e.Status)
+}
+
+func (r *GoProxyRepoConfig) Put(ctx context.Context, modPath, version string, goMod, info, zip, hashes, sig Asset, opts PutOptions) error {
+	return fmt.Errorf("Publishing not supported by repository type: %v", r.Type)
+}
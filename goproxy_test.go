@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoProxyGet(t *testing.T) {
+	var requests []*http.Request
+
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		requests = append(requests, req)
+		switch req.URL.Path {
+		case "/athens/github.com/go-goxm/!module1/@v/list":
+			io.WriteString(resp, "v0.1.0\n")
+		case "/athens/github.com/go-goxm/module2/@v/list":
+			resp.WriteHeader(http.StatusServiceUnavailable)
+		case "/athens/github.com/go-goxm/module3/@v/list":
+			<-release
+		default:
+			resp.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	config, err := LoadConfig(strings.NewReader(`{
+		"repos": {
+			"github.com/go-goxm/*": {
+				"type": "goproxy",
+				"url": "` + upstream.URL + `/athens/",
+				"username": "TestUser",
+				"password": "TestPassword",
+				"timeout": "100ms",
+				"headers": {
+					"X-Test-Header": "TestValue"
+				}
+			}
+		}
+	}`))
+	require.Nilf(t, err, "Error loading config: %v", err)
+
+	repo := config.Repos["github.com/go-goxm/*"].(*GoProxyRepoConfig)
+	require.Equal(t, 100*time.Millisecond, repo.client.Timeout)
+
+	reader, _, err := repo.Get(context.Background(), "github.com/go-goxm/Module1", "@v/list")
+	require.Nil(t, err, err)
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	require.Nil(t, err)
+	require.Equal(t, "v0.1.0\n", string(data))
+
+	require.Len(t, requests, 1)
+	username, password, ok := requests[0].BasicAuth()
+	require.True(t, ok)
+	require.Equal(t, "TestUser", username)
+	require.Equal(t, "TestPassword", password)
+	require.Equal(t, "TestValue", requests[0].Header.Get("X-Test-Header"))
+
+	repo.Token = "TestToken"
+
+	_, status, err := repo.Get(context.Background(), "github.com/go-goxm/Module1", "@v/v0.1.0.zip")
+	require.Error(t, err)
+	require.Equal(t, http.StatusForbidden, status)
+	require.True(t, isAssetNotFound(err), err)
+
+	require.Len(t, requests, 2)
+	require.Equal(t, "/athens/github.com/go-goxm/!module1/@v/v0.1.0.zip", requests[1].URL.Path)
+	require.Equal(t, "Bearer TestToken", requests[1].Header.Get("Authorization"))
+
+	_, status, err = repo.Get(context.Background(), "github.com/go-goxm/Module1", "@latest")
+	require.Error(t, err)
+	require.Equal(t, http.StatusNotFound, status)
+	require.True(t, isAssetNotFound(err), err)
+
+	// Version queries fail with `Bad Gateway` if the server is
+	// unavailable, so that Go does not continue with the next proxy
+	_, status, err = repo.Get(context.Background(), "github.com/go-goxm/module2", "@v/list")
+	require.Error(t, err)
+	require.Equal(t, http.StatusBadGateway, status)
+	require.True(t, isRepositoryUnavailable(err), err)
+
+	_, status, err = repo.Get(context.Background(), "github.com/go-goxm/module3", "@v/list")
+	require.Error(t, err)
+	require.Equal(t, http.StatusBadGateway, status)
+	require.True(t, isRepositoryUnavailable(err), err)
+
+	err = repo.Put(context.Background(), "github.com/go-goxm/Module1", "v0.1.0", nil, nil, nil, nil, nil, PutOptions{})
+	require.Error(t, err)
+
+	_, err = LoadConfig(strings.NewReader(`{
+		"repos": {
+			"github.com/go-goxm/*": {"type": "goproxy", "url": "` + upstream.URL + `", "timeout": "forever"}
+		}
+	}`))
+	require.ErrorContains(t, err, "Malformed repository timeout: forever")
+}
@@ -1,22 +1,24 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"os/exec"
-	"path/filepath"
-	"regexp"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"golang.org/x/exp/maps"
 	"golang.org/x/mod/module"
-	"golang.org/x/mod/zip"
 )
 
 func main() {
@@ -33,6 +35,11 @@ func main() {
 }
 
 func run(ctx context.Context, args []string) error {
+	// Keys are generated before the checksum database is configured
+	if len(args) > 0 && args[0] == "keygen" {
+		return generateKeys(args[1:])
+	}
+
 	config, err := LoadDefaultConfig()
 	if err != nil {
 		return err
@@ -42,10 +49,19 @@ func run(ctx context.Context, args []string) error {
 
 func runWithConfig(ctx context.Context, config *Config, args []string) error {
 
+	args = parseOfflineArgs(config, args)
+
 	if len(args) > 0 && args[0] == "publish" {
+		if config.Offline {
+			return fmt.Errorf("Publishing is not supported in offline mode")
+		}
 		return publish(context.Background(), config, args[1:])
 	}
 
+	if len(args) > 0 && args[0] == "serve" {
+		return serve(ctx, config, args[1:])
+	}
+
 	proxyServer := httptest.NewServer(newProxyHandler(config))
 	defer proxyServer.Close()
 
@@ -54,23 +70,52 @@ func runWithConfig(ctx context.Context, config *Config, args []string) error {
 		goProxy = "https://proxy.golang.org,direct"
 	}
 	goProxy = fmt.Sprintf("%s,%s", proxyServer.URL, goProxy)
+	if config.Offline {
+		// Prevent Go from downloading modules that are not cached
+		goProxy = fmt.Sprintf("%s,off", proxyServer.URL)
+	}
+
+	env := append(os.Environ(), "GOPROXY="+goProxy)
 
-	goNoSumDB := os.Getenv("GONOSUMDB")
-	if goNoSumDB == "" {
-		goNoSumDB = strings.Join(maps.Keys(config.Repos), ",")
+	// Modules are verified with the private checksum database if GOSUMDB
+	// is set to its name, otherwise verification of the modules is disabled
+	goSumDB := os.Getenv("GOSUMDB")
+	if config.SumDB != nil && (goSumDB == config.SumDB.Name || goSumDB == config.SumDB.Key) {
+		env = append(env, "GOSUMDB="+config.SumDB.Key)
 	} else {
-		goNoSumDB += "," + strings.Join(maps.Keys(config.Repos), ",")
+		goNoSumDB := os.Getenv("GONOSUMDB")
+		if goNoSumDB == "" {
+			goNoSumDB = strings.Join(maps.Keys(config.Repos), ",")
+		} else {
+			goNoSumDB += "," + strings.Join(maps.Keys(config.Repos), ",")
+		}
+		env = append(env, "GONOSUMDB="+goNoSumDB)
 	}
 
 	cmd := exec.Command("go")
 	cmd.Args = append(cmd.Args, args...)
-	cmd.Env = append(os.Environ(), "GOPROXY="+goProxy, "GONOSUMDB="+goNoSumDB)
+	cmd.Env = env
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
 
+// parseOfflineArgs enables offline mode if either the `--offline` flag
+// precedes the command or the GOXM_OFFLINE environment variable is set,
+// and returns the remaining arguments
+func parseOfflineArgs(config *Config, args []string) []string {
+	if offline, _ := strconv.ParseBool(os.Getenv("GOXM_OFFLINE")); offline {
+		config.Offline = true
+	}
+
+	for len(args) > 0 && (args[0] == "--offline" || args[0] == "-offline") {
+		config.Offline = true
+		args = args[1:]
+	}
+	return args
+}
+
 func newProxyHandler(config *Config) http.Handler {
 	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
 		if req.Method != http.MethodGet {
@@ -79,6 +124,10 @@ func newProxyHandler(config *Config) http.Handler {
 		}
 
 		if strings.HasPrefix(req.URL.Path, "/sumdb") {
+			if config.SumDB != nil {
+				config.SumDB.ServeHTTP(resp, req)
+				return
+			}
 			resp.WriteHeader(http.StatusNotFound)
 			return
 		}
@@ -99,94 +148,102 @@ func newProxyHandler(config *Config) http.Handler {
 
 		attifact := req.URL.Path[atIndex:]
 
-		for moduleGlob, repository := range config.Repos {
-			match, _ := regexp.MatchString(globToRegexp(moduleGlob), modPath)
-			if !match {
-				continue
-			}
-
-			reader, status, err := repository.Get(req.Context(), modPath, attifact)
-			if err != nil {
-				// Respond with `Forbidden`` to prevent Go from
-				// trying to get the module from another proxy
-				resp.WriteHeader(status)
-				logf("%v", err)
-				return
-			}
-
-			_, err = io.Copy(resp, reader)
-			if err != nil {
-				logf("Error writing response: %v: %v", req.URL.Path, err)
-				return
-			}
-			reader.Close()
+		moduleGlobs, repository, ok := config.findRepository(modPath)
+		if !ok {
+			resp.WriteHeader(http.StatusNotFound)
+			return
+		}
 
+		reader, status, err := getAsset(req.Context(), config, repository, modPath, attifact)
+		if err == nil {
+			status = http.StatusForbidden
+			reader, err = verifyAsset(req.Context(), config, repository, config.Signatures[moduleGlobs], modPath, attifact, reader)
+		}
+		if err != nil {
+			// Respond with `Forbidden`` to prevent Go from
+			// trying to get the module from another proxy
+			resp.WriteHeader(status)
+			logf("%v", err)
 			return
 		}
+		defer reader.Close()
 
-		resp.WriteHeader(http.StatusNotFound)
+		_, err = io.Copy(resp, reader)
+		if err != nil {
+			logf("Error writing response: %v: %v", req.URL.Path, err)
+			return
+		}
 	})
 }
 
-func publish(ctx context.Context, config *Config, args []string) error {
-
-	if len(args) == 0 || len(args) > 1 {
-		return fmt.Errorf("Unsupported arguments: Usage: goxm publish <version>")
+// getAsset gets the asset from the repository, or the cache if configured
+func getAsset(ctx context.Context, config *Config, repository Repository, modPath, attifact string) (io.ReadCloser, int, error) {
+	switch {
+	case config.Offline && config.Cache == nil:
+		return nil, http.StatusNotFound, fmt.Errorf("Asset not available offline without a cache: %v/%v", modPath, attifact)
+	case config.Offline:
+		return config.Cache.GetOffline(modPath, attifact)
+	case config.Cache != nil:
+		return config.Cache.Get(ctx, repository, modPath, attifact)
+	default:
+		return repository.Get(ctx, modPath, attifact)
 	}
+}
 
-	version := strings.TrimSpace(args[0])
+func serve(ctx context.Context, config *Config, args []string) error {
 
-	modPath, goModData, goModFilePath, err := getGoModule(ctx)
-	if err != nil {
-		return err
-	}
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	listenAddr := flags.String("listen", "localhost:8080", "Address for the proxy server to listen on")
+	flags.BoolVar(&config.Offline, "offline", config.Offline, "Serve assets only from the cache")
 
-	infoData, gitRootPath, err := getGoInfoFromGit(ctx, version)
-	if err != nil {
-		return err
+	err := flags.Parse(args)
+	if err != nil || flags.NArg() > 0 {
+		return fmt.Errorf("Unsupported arguments: Usage: goxm serve [--listen <address>] [--offline]")
 	}
 
-	subDir, err := filepath.Rel(gitRootPath, filepath.Dir(goModFilePath))
+	listener, err := net.Listen("tcp", *listenAddr)
 	if err != nil {
-		return fmt.Errorf("Unable to resolve relative path to Git repository: %w", err)
+		return fmt.Errorf("Error listening on address: %v: %w", *listenAddr, err)
 	}
 
-	if subDir == "." {
-		// If the Git root and the module directories are the same
-		// then clear `subDir` so that all paths are included in
-		// the zip file and not just the ones starting with "."
-		// See the `CreateFromVCS()` docs for more information
-		subDir = ""
-	} else if strings.HasPrefix(subDir, "..") {
-		return fmt.Errorf("Unable to resolve go.mod path within Git repository")
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return serveListener(ctx, config, listener)
+}
+
+func serveListener(ctx context.Context, config *Config, listener net.Listener) error {
+
+	server := &http.Server{
+		Handler: newProxyHandler(config),
 	}
 
-	modVersion := module.Version{
-		Path:    modPath,
-		Version: version,
+	logf("Serving proxy on http://%v", listener.Addr())
+	if config.SumDB != nil {
+		logf("Set GOSUMDB=%v", config.SumDB.Key)
+	} else {
+		logf("Set GONOSUMDB=%v", strings.Join(maps.Keys(config.Repos), ","))
 	}
 
-	zipBuffer := bytes.NewBuffer(nil)
-	err = zip.CreateFromVCS(zipBuffer, modVersion, gitRootPath, version, subDir)
-	if err != nil {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
 		return err
+	case <-ctx.Done():
 	}
 
-	for moduleGlob, repository := range config.Repos {
-		match, _ := regexp.MatchString(globToRegexp(moduleGlob), modPath)
-		if !match {
-			continue
-		}
+	// Allow in-progress downloads to complete before exiting
+	logf("Shutting down proxy server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
-		return repository.Put(
-			context.Background(),
-			modPath,
-			version,
-			goModData,
-			infoData,
-			zipBuffer.Bytes(),
-		)
+	err := server.Shutdown(shutdownCtx)
+	if err != nil {
+		return fmt.Errorf("Error shutting down proxy server: %w", err)
 	}
-
-	return fmt.Errorf("No repository found matching module: %v", modPath)
+	return nil
 }
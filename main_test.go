@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServe(t *testing.T) {
+	repo := &FileSystemRepoConfig{Path: t.TempDir()}
+
+	err := repo.Put(
+		context.Background(),
+		"github.com/go-goxm/ca_module1",
+		"v0.1.0",
+		newBytesAsset(readFile(t, "./testdata/ca_module1_assets/v0.1.0.mod")),
+		newBytesAsset(readFile(t, "./testdata/ca_module1_assets/v0.1.0.info")),
+		newBytesAsset(readFile(t, "./testdata/ca_module1_assets/v0.1.0.zip")),
+		newTestAssetHashes(t,
+			"github.com/go-goxm/ca_module1",
+			"v0.1.0",
+			readFile(t, "./testdata/ca_module1_assets/v0.1.0.mod"),
+			readFile(t, "./testdata/ca_module1_assets/v0.1.0.info"),
+			readFile(t, "./testdata/ca_module1_assets/v0.1.0.zip"),
+		),
+		nil,
+		PutOptions{},
+	)
+	require.Nil(t, err, err)
+
+	config, err := newConfig(map[string]Repository{
+		"github.com/go-goxm/*": repo,
+	})
+	require.Nil(t, err, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- serveListener(ctx, config, listener)
+	}()
+
+	resp, err := http.Get("http://" + listener.Addr().String() + "/github.com/go-goxm/ca_module1/@v/list")
+	require.Nil(t, err, err)
+
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "v0.1.0\n", string(data))
+
+	resp, err = http.Get("http://" + listener.Addr().String() + "/github.com/example/module/@v/list")
+	require.Nil(t, err, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	cancel()
+	require.Nil(t, <-serveErr)
+
+	err = serve(context.Background(), config, []string{"--listen", "127.0.0.1:0", "extra"})
+	require.Error(t, err)
+}
+
+func TestOffline(t *testing.T) {
+	t.Setenv("GOXM_OFFLINE", "")
+
+	cache := &Cache{Dir: t.TempDir(), TTL: 0}
+
+	repo := &MockRepository{
+		GetFunc: func(ctx context.Context, module, attifact string) (io.ReadCloser, int, error) {
+			return io.NopCloser(strings.NewReader("v0.1.0\n")), 0, nil
+		},
+	}
+
+	reader, _, err := cache.Get(context.Background(), repo, "github.com/go-goxm/ca_module1", "@v/list")
+	require.Nil(t, err, err)
+	reader.Close()
+
+	config, err := newConfig(map[string]Repository{
+		"github.com/go-goxm/*": &MockRepository{
+			GetFunc: func(ctx context.Context, module, attifact string) (io.ReadCloser, int, error) {
+				t.Fatalf("Repository must not be used in offline mode: %v/%v", module, attifact)
+				return nil, 0, nil
+			},
+		},
+	})
+	require.Nil(t, err, err)
+	config.Cache = cache
+
+	args := parseOfflineArgs(config, []string{"--offline", "build", "--offline"})
+	require.Equal(t, []string{"build", "--offline"}, args)
+	require.True(t, config.Offline)
+
+	proxyServer := httptest.NewServer(newProxyHandler(config))
+	defer proxyServer.Close()
+
+	resp, err := http.Get(proxyServer.URL + "/github.com/go-goxm/ca_module1/@v/list")
+	require.Nil(t, err, err)
+
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "v0.1.0\n", string(data))
+
+	resp, err = http.Get(proxyServer.URL + "/github.com/go-goxm/ca_module1/@v/v0.1.0.zip")
+	require.Nil(t, err, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	err = runWithConfig(context.Background(), config, []string{"publish", "v0.1.0"})
+	require.Error(t, err)
+
+	config.Offline = false
+	t.Setenv("GOXM_OFFLINE", "1")
+	parseOfflineArgs(config, nil)
+	require.True(t, config.Offline)
+}
@@ -0,0 +1,728 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"golang.org/x/mod/sumdb/dirhash"
+	"golang.org/x/mod/zip"
+)
+
+type modulePublication struct {
+	modPath    string
+	version    string
+	revision   string
+	subDir     string
+	goModData  []byte
+	infoData   []byte
+	hashesData []byte
+	sigData    []byte
+	zip        *fileAsset
+	repository Repository
+
+	// zipHash and goModHash are the hashes recorded in go.sum
+	zipHash   string
+	goModHash string
+	sumDB     *SumDB
+}
+
+type publishOptions struct {
+	// dryRun writes the assets to outDir instead of the repository
+	dryRun bool
+	outDir string
+
+	PutOptions
+}
+
+func publish(ctx context.Context, config *Config, args []string) error {
+
+	flags := flag.NewFlagSet("publish", flag.ContinueOnError)
+	all := flags.Bool("all", false, "Publish every module in the Git repository tagged at HEAD")
+	pseudo := flags.Bool("pseudo", false, "Publish a pseudo-version of a Git revision (HEAD by default)")
+
+	var opts publishOptions
+	flags.BoolVar(&opts.dryRun, "dry-run", false, "Write the assets to a directory instead of publishing")
+	flags.StringVar(&opts.outDir, "out", "", "Directory to write the assets to for a dry run")
+	flags.BoolVar(&opts.Force, "force", false, "Overwrite a version already published with different content")
+	flags.BoolVar(&opts.Resume, "resume", false, "Finish publishing a version left unfinished by an interrupted publish")
+	flags.BoolVar(&opts.Discard, "discard", false, "Delete a version left unfinished by an interrupted publish and publish it again")
+
+	err := flags.Parse(args)
+	var exclusive int
+	for _, flag := range []bool{opts.Force, opts.Resume, opts.Discard} {
+		if flag {
+			exclusive++
+		}
+	}
+
+	if err != nil || (*all && (*pseudo || flags.NArg() != 0)) || (*pseudo && flags.NArg() > 1) ||
+		(!*all && !*pseudo && flags.NArg() != 1) || (opts.outDir != "" && !opts.dryRun) || exclusive > 1 {
+		return fmt.Errorf("Unsupported arguments: Usage: goxm publish [--force | --resume | --discard] [--dry-run [--out <dir>]] (<version> | --all | --pseudo [<revision>])")
+	}
+
+	gitRootPath, err := getGitRootPath(ctx)
+	if err != nil {
+		return err
+	}
+
+	if *all {
+		return publishAll(ctx, config, gitRootPath, opts)
+	}
+
+	subDir, err := getGitSubDir(gitRootPath)
+	if err != nil {
+		return err
+	}
+
+	// A pseudo-version of the revision is published if no version is specified
+	var revision, version string
+	if *pseudo {
+		revision = "HEAD"
+		if flags.NArg() > 0 {
+			revision = strings.TrimSpace(flags.Arg(0))
+		}
+	} else {
+		revision, version = resolveGitTag(ctx, gitRootPath, subDir, strings.TrimSpace(flags.Arg(0)))
+	}
+
+	pub, err := preparePublication(ctx, config, gitRootPath, subDir, revision, version)
+	if err != nil {
+		return err
+	}
+	defer pub.release()
+
+	// The module may have been renamed since the revision, for example
+	// to add a major version suffix, so a mismatch is only reported
+	workingModName, _, _, err := getGoModule(ctx)
+	if err == nil && workingModName != pub.modPath {
+		logf("Go module name at Git revision differs from working tree: %v: %v != %v", revision, pub.modPath, workingModName)
+	}
+
+	if opts.dryRun {
+		return writeDryRun(opts.outDir, []*modulePublication{pub})
+	}
+
+	return pub.publish(ctx, opts.PutOptions)
+}
+
+// publishAll publishes every module tagged at HEAD, once all of
+// them are prepared, in dependency order
+func publishAll(ctx context.Context, config *Config, gitRootPath string, opts publishOptions) error {
+
+	subDirs, err := findGoModules(ctx, gitRootPath)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "tag", "--points-at", "HEAD")
+	cmd.Dir = gitRootPath
+
+	tagsOutput, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("Error listing Git tags at HEAD: %w", err)
+	}
+	tags := strings.Fields(string(tagsOutput))
+
+	var pubs []*modulePublication
+	defer func() {
+		for _, pub := range pubs {
+			pub.release()
+		}
+	}()
+
+	for _, subDir := range subDirs {
+		var published bool
+		for _, tag := range tags {
+			revision, version, ok := matchGitTag(subDir, tag)
+			if !ok {
+				continue
+			}
+
+			modPath, _, err := getGoModuleFromGit(ctx, gitRootPath, revision, subDir)
+			if err != nil {
+				return err
+			}
+
+			// Major version sub directories share a tag prefix with the
+			// parent module so skip tags for a different major version
+			if module.Check(modPath, version) != nil {
+				continue
+			}
+
+			pub, err := preparePublication(ctx, config, gitRootPath, subDir, revision, version)
+			if err != nil {
+				return err
+			}
+
+			pubs = append(pubs, pub)
+			published = true
+		}
+
+		if !published {
+			logf("Skipping module without a version tagged at HEAD: %v", path.Join("/", subDir))
+		}
+	}
+
+	if len(pubs) == 0 {
+		return fmt.Errorf("No modules found with a version tagged at HEAD")
+	}
+
+	sortedPubs, err := sortPublications(pubs)
+	if err != nil {
+		return err
+	}
+
+	if opts.dryRun {
+		return writeDryRun(opts.outDir, sortedPubs)
+	}
+
+	for i, pub := range sortedPubs {
+		err = pub.publish(ctx, opts.PutOptions)
+		if err != nil {
+			return fmt.Errorf("%w\nPublished: %v\nNot published: %v", err, publicationsString(sortedPubs[:i]), publicationsString(sortedPubs[i:]))
+		}
+	}
+
+	return nil
+}
+
+func preparePublication(ctx context.Context, config *Config, gitRootPath, subDir, revision, version string) (*modulePublication, error) {
+
+	if version != "" && module.CanonicalVersion(version) != version {
+		if semver.IsValid("v" + version) {
+			return nil, fmt.Errorf("Version is not a canonical semantic version: %v (did you mean v%v?)", version, version)
+		}
+		return nil, fmt.Errorf("Version is not a canonical semantic version: %v", version)
+	}
+
+	// The commit is resolved once so that the assets are
+	// all created from it, even if the revision is moved
+	commit, err := resolveGitCommit(ctx, gitRootPath, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	if version == "" {
+		version, err = pseudoVersion(ctx, gitRootPath, subDir, commit)
+		if err != nil {
+			return nil, err
+		}
+		revision = commit
+	}
+
+	// The go.mod file is read from the Git revision, and not the
+	// working tree, so that the version does not need to be checked
+	// out and the published go.mod always matches the zip file
+	modPath, goModData, err := getGoModuleFromGit(ctx, gitRootPath, commit, subDir)
+	if err != nil {
+		return nil, err
+	}
+
+	infoData, err := getGoInfoFromGit(ctx, gitRootPath, revision, commit, subDir, version)
+	if err != nil {
+		return nil, err
+	}
+
+	// The major version must match the module path suffix (`/v2`, `.v2`)
+	// unless the version is `+incompatible`
+	err = module.Check(modPath, version)
+	if err != nil {
+		return nil, fmt.Errorf("Version is not valid for module: %w", err)
+	}
+
+	files, releaseFiles, err := gitArchiveFiles(ctx, gitRootPath, commit, subDir)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseFiles()
+
+	checkedFiles, err := zip.CheckFiles(files)
+	for _, omitted := range checkedFiles.Omitted {
+		logf("Omitted file from module zip: %v", omitted)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid files for module zip: %v@%v:\n%w", modPath, version, err)
+	}
+
+	modVersion := module.Version{
+		Path:    modPath,
+		Version: version,
+	}
+
+	moduleGlobs, repository, ok := config.findRepository(modPath)
+	if !ok {
+		return nil, fmt.Errorf("No repository found matching module: %v", modPath)
+	}
+
+	// The zip file is spooled to a temporary file,
+	// rather than memory, because it can be large
+	zipAsset, err := newFileAsset("goxm-*.zip", func(w io.Writer) error {
+		return zip.Create(w, modVersion, files)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error creating module zip: %v@%v: %w", modPath, version, err)
+	}
+
+	pub := &modulePublication{
+		modPath:    modPath,
+		version:    version,
+		revision:   revision,
+		subDir:     subDir,
+		goModData:  goModData,
+		infoData:   infoData,
+		zip:        zipAsset,
+		repository: repository,
+		sumDB:      config.SumDB,
+	}
+
+	pub.zipHash, err = dirhash.HashZip(zipAsset.name, dirhash.Hash1)
+	if err != nil {
+		pub.release()
+		return nil, fmt.Errorf("Error hashing module zip: %v@%v: %w", modPath, version, err)
+	}
+
+	pub.goModHash, err = goModSum(goModData)
+	if err != nil {
+		pub.release()
+		return nil, fmt.Errorf("Error hashing module go.mod: %v@%v: %w", modPath, version, err)
+	}
+
+	// The hashes are published with the version so
+	// that downloads can be verified by the proxy
+	pub.hashesData, err = json.MarshalIndent(&AssetHashes{
+		Path:     modPath,
+		Version:  version,
+		Sum:      pub.zipHash,
+		GoModSum: pub.goModHash,
+		SHA256: map[string]string{
+			".info": newBytesAsset(infoData).SHA256(),
+			".mod":  newBytesAsset(goModData).SHA256(),
+			".zip":  zipAsset.SHA256(),
+		},
+	}, "", "    ")
+	if err != nil {
+		pub.release()
+		return nil, err
+	}
+	pub.hashesData = append(pub.hashesData, '\n')
+
+	if signatures := config.Signatures[moduleGlobs]; signatures != nil && signatures.SignerKeyFile != "" {
+		pub.sigData, err = signatures.sign(pub.hashesData)
+		if err != nil {
+			pub.release()
+			return nil, err
+		}
+	}
+
+	// A version recorded in the checksum database can not be
+	// published with different content, even with `--force`, and
+	// the signer key is loaded so that a version is not published
+	// if it can not be added to the checksum database
+	if pub.sumDB != nil {
+		err = pub.sumDB.Check(modPath, version, pub.zipHash, pub.goModHash)
+		if err == nil {
+			_, err = pub.sumDB.signer()
+		}
+		if err != nil {
+			pub.release()
+			return nil, err
+		}
+	}
+
+	return pub, nil
+}
+
+func (p *modulePublication) publish(ctx context.Context, opts PutOptions) error {
+	var sig Asset
+	if p.sigData != nil {
+		sig = newBytesAsset(p.sigData)
+	}
+
+	err := p.repository.Put(
+		ctx,
+		p.modPath,
+		p.version,
+		newBytesAsset(p.goModData),
+		newBytesAsset(p.infoData),
+		p.zip,
+		newBytesAsset(p.hashesData),
+		sig,
+		opts,
+	)
+	if err != nil {
+		return err
+	}
+
+	// The hashes are recorded after the version is published, so a failed
+	// publish can be retried, and a failure to record the hashes is fixed by
+	// publishing the identical version again
+	if p.sumDB != nil {
+		return p.sumDB.Add(p.modPath, p.version, p.zipHash, p.goModHash)
+	}
+	return nil
+}
+
+// release removes the temporary files of the publication
+func (p *modulePublication) release() {
+	err := p.zip.Remove()
+	if err != nil {
+		logf("Error removing temporary file: %v", err)
+	}
+}
+
+// writeDryRun writes the assets that would be published to the
+// directory, or a temporary directory, laid out like a `GOPROXY` tree
+func writeDryRun(outDir string, pubs []*modulePublication) error {
+
+	var err error
+	if outDir == "" {
+		outDir, err = os.MkdirTemp("", "goxm-publish-")
+	} else {
+		err = os.MkdirAll(outDir, 0o755)
+	}
+	if err != nil {
+		return fmt.Errorf("Error creating dry run directory: %w", err)
+	}
+
+	var sha256Sums, goSum []string
+	for _, pub := range pubs {
+		escapedPath, err := module.EscapePath(pub.modPath)
+		if err != nil {
+			return err
+		}
+
+		escapedVersion, err := module.EscapeVersion(pub.version)
+		if err != nil {
+			return err
+		}
+
+		assetDir := path.Join(escapedPath, "@v")
+		err = os.MkdirAll(filepath.Join(outDir, filepath.FromSlash(assetDir)), 0o755)
+		if err != nil {
+			return fmt.Errorf("Error creating dry run directory: %w", err)
+		}
+
+		type extAsset struct {
+			ext   string
+			asset Asset
+		}
+
+		assets := []extAsset{
+			{".info", newBytesAsset(pub.infoData)},
+			{".mod", newBytesAsset(pub.goModData)},
+			{".zip", pub.zip},
+			{".hashes", newBytesAsset(pub.hashesData)},
+		}
+		if pub.sigData != nil {
+			assets = append(assets, extAsset{".sig", newBytesAsset(pub.sigData)})
+		}
+
+		for _, asset := range assets {
+			assetPath := path.Join(assetDir, escapedVersion+asset.ext)
+			err = writeAsset(filepath.Join(outDir, filepath.FromSlash(assetPath)), asset.asset)
+			if err != nil {
+				return fmt.Errorf("Error writing dry run asset: %v: %w", assetPath, err)
+			}
+
+			sha256Sums = append(sha256Sums, fmt.Sprintf("%v  %v\n", asset.asset.SHA256(), assetPath))
+		}
+
+		goSum = append(goSum, goSumLines(pub.modPath, pub.version, pub.zipHash, pub.goModHash))
+
+		logf("Dry run of publishing module: %v@%v", pub.modPath, pub.version)
+	}
+
+	err = writeFileAtomic(filepath.Join(outDir, "SHA256SUMS"), []byte(strings.Join(sha256Sums, "")))
+	if err != nil {
+		return fmt.Errorf("Error writing dry run checksums: %w", err)
+	}
+
+	err = writeFileAtomic(filepath.Join(outDir, "go.sum"), []byte(strings.Join(goSum, "")))
+	if err != nil {
+		return fmt.Errorf("Error writing dry run checksums: %w", err)
+	}
+
+	logf("Wrote dry run assets to: %v", outDir)
+	return nil
+}
+
+// findGoModules returns the sub directories of the modules in the
+// Git repository, either listed in the go.work file at the root of the
+// repository, or else every go.mod file committed at HEAD
+func findGoModules(ctx context.Context, gitRootPath string) ([]string, error) {
+
+	cmd := exec.CommandContext(ctx, "git", "ls-tree", "-r", "--name-only", "HEAD")
+	cmd.Dir = gitRootPath
+
+	filesOutput, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Error listing Git files at HEAD: %w", err)
+	}
+	files := strings.Split(string(filesOutput), "\n")
+
+	// The go.work file is read at HEAD, like the modules,
+	// so that changes in the working tree are not published
+	if slices.Contains(files, "go.work") {
+		cmd := exec.CommandContext(ctx, "git", "show", "HEAD:go.work")
+		cmd.Dir = gitRootPath
+
+		goWorkData, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("Error reading Go workspace file (go.work) at HEAD: %w", err)
+		}
+
+		goWork, err := modfile.ParseWork("go.work", goWorkData, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Go workspace file (go.work) could not be parsed: %w", err)
+		}
+
+		var subDirs []string
+		for _, use := range goWork.Use {
+			subDir := path.Clean(filepath.ToSlash(use.Path))
+			if subDir == "." {
+				subDir = ""
+			} else if filepath.IsAbs(use.Path) || strings.HasPrefix(subDir, "..") {
+				return nil, fmt.Errorf("Go workspace module not within Git repository: %v", use.Path)
+			}
+			subDirs = append(subDirs, subDir)
+		}
+		sort.Strings(subDirs)
+
+		return slices.Compact(subDirs), nil
+	}
+
+	var subDirs []string
+	for _, file := range files {
+		if path.Base(file) != "go.mod" {
+			continue
+		}
+
+		subDir := path.Dir(file)
+		if subDir == "." {
+			subDir = ""
+		}
+
+		// Skip the directories ignored by the go command
+		ignored := false
+		for _, elem := range strings.Split(subDir, "/") {
+			if elem == "testdata" || elem == "vendor" || strings.HasPrefix(elem, ".") || strings.HasPrefix(elem, "_") {
+				ignored = true
+			}
+		}
+
+		if !ignored {
+			subDirs = append(subDirs, subDir)
+		}
+	}
+	sort.Strings(subDirs)
+
+	return subDirs, nil
+}
+
+// sortPublications orders the publications so that modules
+// are published after the modules they require
+func sortPublications(pubs []*modulePublication) ([]*modulePublication, error) {
+
+	requires := map[*modulePublication][]*modulePublication{}
+	for _, pub := range pubs {
+		goMod, err := modfile.ParseLax("go.mod", pub.goModData, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Go module file (go.mod) could not be parsed: %v: %w", pub.modPath, err)
+		}
+
+		for _, req := range goMod.Require {
+			for _, dep := range pubs {
+				if dep != pub && dep.modPath == req.Mod.Path {
+					requires[pub] = append(requires[pub], dep)
+				}
+			}
+		}
+	}
+
+	var sorted []*modulePublication
+	visited := map[*modulePublication]bool{}
+	visiting := map[*modulePublication]bool{}
+
+	var visit func(pub *modulePublication) error
+	visit = func(pub *modulePublication) error {
+		if visited[pub] {
+			return nil
+		}
+		if visiting[pub] {
+			return fmt.Errorf("Module requirement cycle found: %v", pub.modPath)
+		}
+
+		visiting[pub] = true
+		for _, dep := range requires[pub] {
+			err := visit(dep)
+			if err != nil {
+				return err
+			}
+		}
+		visiting[pub] = false
+
+		visited[pub] = true
+		sorted = append(sorted, pub)
+		return nil
+	}
+
+	for _, pub := range pubs {
+		err := visit(pub)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sorted, nil
+}
+
+func publicationsString(pubs []*modulePublication) string {
+	var strs []string
+	for _, pub := range pubs {
+		strs = append(strs, pub.modPath+"@"+pub.version)
+	}
+	if len(strs) == 0 {
+		return "none"
+	}
+	return strings.Join(strs, ", ")
+}
+
+// getGitSubDir returns the slash separated path of the current
+// directory relative to the root of the Git repository
+func getGitSubDir(gitRootPath string) (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	// Resolve symbolic links because Git reports the real path
+	cwd, err = filepath.EvalSymlinks(cwd)
+	if err != nil {
+		return "", err
+	}
+
+	gitRootPath, err = filepath.EvalSymlinks(gitRootPath)
+	if err != nil {
+		return "", err
+	}
+
+	subDir, err := filepath.Rel(gitRootPath, cwd)
+	if err != nil {
+		return "", fmt.Errorf("Unable to resolve relative path to Git repository: %w", err)
+	}
+
+	if subDir == "." {
+		// If the Git root and the module directories are the same
+		// then clear `subDir`, because `gitArchiveFiles` only archives
+		// and strips a sub directory that is not empty, so that all
+		// paths are included in the zip file and not just the ones
+		// starting with "./"
+		return "", nil
+	} else if strings.HasPrefix(subDir, "..") {
+		return "", fmt.Errorf("Unable to resolve go.mod path within Git repository")
+	}
+
+	return filepath.ToSlash(subDir), nil
+}
+
+// resolveGitTag returns the Git revision and the module version to publish,
+// from a tag prefixed with the module sub directory if it exists or is specified
+func resolveGitTag(ctx context.Context, gitRootPath, subDir, tag string) (string, string) {
+	tagPrefixes := gitTagPrefixes(subDir)
+
+	for _, tagPrefix := range tagPrefixes {
+		if version, ok := strings.CutPrefix(tag, tagPrefix); ok && tagPrefix != "" {
+			return tag, version
+		}
+	}
+
+	for _, tagPrefix := range tagPrefixes {
+		cmd := exec.CommandContext(ctx, "git", "rev-parse", "--verify", "--quiet", "refs/tags/"+tagPrefix+tag)
+		cmd.Dir = gitRootPath
+		if tagPrefix != "" && cmd.Run() == nil {
+			return tagPrefix + tag, tag
+		}
+	}
+
+	return tag, tag
+}
+
+// pseudoVersion returns the pseudo-version for the Git commit hash
+func pseudoVersion(ctx context.Context, gitRootPath, subDir, hash string) (string, error) {
+
+	modPath, _, err := getGoModuleFromGit(ctx, gitRootPath, hash, subDir)
+	if err != nil {
+		return "", err
+	}
+
+	commitTime, err := getGitCommitTime(ctx, gitRootPath, hash)
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "tag", "--merged", hash)
+	cmd.Dir = gitRootPath
+
+	tagsOutput, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("Error listing Git tags merged into commit: %v: %w", hash, err)
+	}
+
+	var baseVersion string
+	for _, tag := range strings.Fields(string(tagsOutput)) {
+		_, version, ok := matchGitTag(subDir, tag)
+		if !ok || module.IsPseudoVersion(version) || module.Check(modPath, version) != nil {
+			continue
+		}
+		if semver.Compare(version, baseVersion) > 0 {
+			baseVersion = version
+		}
+	}
+
+	_, pathMajor, _ := module.SplitPathVersion(modPath)
+	version := module.PseudoVersion(module.PathMajorPrefix(pathMajor), baseVersion, commitTime, hash[:12])
+
+	logf("Resolved pseudo-version for Git commit: %v: %v@%v", hash, modPath, version)
+	return version, nil
+}
+
+// matchGitTag reports whether the tag is a semantic version
+// for the module in the sub directory of the Git repository
+func matchGitTag(subDir, tag string) (string, string, bool) {
+	for _, tagPrefix := range gitTagPrefixes(subDir) {
+		if version, ok := strings.CutPrefix(tag, tagPrefix); ok && semver.IsValid(version) {
+			return tag, version, true
+		}
+	}
+	return "", "", false
+}
+
+// gitTagPrefixes returns the possible tag prefixes
+// for a module in the sub directory of the Git repository
+func gitTagPrefixes(subDir string) []string {
+	if subDir == "" {
+		return []string{""}
+	}
+
+	tagPrefixes := []string{subDir + "/"}
+
+	parentDir, majorDir := path.Split(subDir)
+	if _, pathMajor, ok := module.SplitPathVersion("/" + majorDir); ok && pathMajor == "/"+majorDir {
+		tagPrefixes = append(tagPrefixes, parentDir)
+	}
+
+	return tagPrefixes
+}
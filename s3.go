@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"golang.org/x/exp/slices"
+	"golang.org/x/mod/module"
+)
+
+type S3Client interface {
+	GetObject(
+		ctx context.Context,
+		params *s3.GetObjectInput,
+		optFns ...func(*s3.Options),
+	) (*s3.GetObjectOutput, error)
+
+	HeadObject(
+		ctx context.Context,
+		params *s3.HeadObjectInput,
+		optFns ...func(*s3.Options),
+	) (*s3.HeadObjectOutput, error)
+
+	PutObject(
+		ctx context.Context,
+		params *s3.PutObjectInput,
+		optFns ...func(*s3.Options),
+	) (*s3.PutObjectOutput, error)
+
+	DeleteObject(
+		ctx context.Context,
+		params *s3.DeleteObjectInput,
+		optFns ...func(*s3.Options),
+	) (*s3.DeleteObjectOutput, error)
+}
+
+type S3RepoConfig struct {
+	RepoTypeConfig
+	Bucket       *string `json:"bucket"`
+	Prefix       string  `json:"prefix"`
+	Region       string  `json:"region"`
+	Endpoint     string  `json:"endpoint"`
+	UsePathStyle bool    `json:"use_path_style"`
+
+	client S3Client
+}
+
+func (r *S3RepoConfig) Get(ctx context.Context, module, attifact string) (io.ReadCloser, int, error) {
+	client, err := r.getClient(ctx)
+	if err != nil {
+		return nil, http.StatusForbidden, err
+	}
+
+	if attifact == "@latest" || attifact == "@v/list" {
+		key, err := r.objectKey(module, attifact)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+
+		input := &s3.GetObjectInput{
+			Bucket: r.Bucket,
+			Key:    aws.String(key),
+		}
+
+		output, err := client.GetObject(ctx, input)
+		if err != nil {
+			return nil, http.StatusNotFound, fmt.Errorf("Error getting S3 object: %v: %w", s3ObjectString(input.Bucket, input.Key), err)
+		}
+		logf("Got S3 object: %v", s3ObjectString(input.Bucket, input.Key))
+
+		return output.Body, 0, nil
+	}
+
+	asset, ok := strings.CutPrefix(attifact, "@v/")
+	if !ok || strings.Contains(asset, "/") {
+		return nil, http.StatusBadRequest, fmt.Errorf("Asset path not supported: %v/%v", module, attifact)
+	}
+
+	if !slices.Contains(assetExtensions, path.Ext(asset)) {
+		return nil, http.StatusForbidden, fmt.Errorf("Asset extension not supported: %v/%v", module, attifact)
+	}
+
+	key, err := r.objectKey(module, attifact)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: r.Bucket,
+		Key:    aws.String(key),
+	}
+
+	output, err := client.GetObject(ctx, input)
+	if s3ObjectMissing(err) {
+		err = assetNotFoundError{err}
+	}
+	if err != nil {
+		return nil, http.StatusForbidden, fmt.Errorf("Error getting S3 object: %v: %w", s3ObjectString(input.Bucket, input.Key), err)
+	}
+	logf("Got S3 object: %v", s3ObjectString(input.Bucket, input.Key))
+
+	return output.Body, 0, nil
+}
+
+func (r *S3RepoConfig) Put(ctx context.Context, modPath, version string, goMod, info, zip, hashes, sig Asset, opts PutOptions) error {
+
+	client, err := r.getClient(ctx)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	tree := &s3Tree{ctx: ctx, repo: r, client: client, modPath: modPath}
+	return putProxyTree(tree, modPath, version, goMod, info, zip, hashes, sig, opts)
+}
+
+// s3Tree is the prefix of a module in an S3 repository
+type s3Tree struct {
+	ctx     context.Context
+	repo    *S3RepoConfig
+	client  S3Client
+	modPath string
+}
+
+func (t *s3Tree) sha256(name string) (string, bool, error) {
+	key, err := t.repo.objectKey(t.modPath, name)
+	if err != nil {
+		return "", false, err
+	}
+	return t.repo.objectSHA256(t.ctx, t.client, key)
+}
+
+func (t *s3Tree) read(name string) ([]byte, bool, error) {
+	key, err := t.repo.objectKey(t.modPath, name)
+	if err != nil {
+		return nil, false, err
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: t.repo.Bucket,
+		Key:    aws.String(key),
+	}
+
+	output, err := t.client.GetObject(t.ctx, input)
+	if s3ObjectMissing(err) && !s3AccessDenied(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, fmt.Errorf("Error getting S3 object: %v: %w", s3ObjectString(input.Bucket, input.Key), err)
+	}
+	defer output.Body.Close()
+
+	data, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil, false, fmt.Errorf("Error reading S3 object: %v: %w", s3ObjectString(input.Bucket, input.Key), err)
+	}
+	return data, true, nil
+}
+
+func (t *s3Tree) write(name string, asset Asset) error {
+	key, err := t.repo.objectKey(t.modPath, name)
+	if err != nil {
+		return err
+	}
+	return t.repo.putObject(t.ctx, t.client, key, asset)
+}
+
+func (t *s3Tree) remove(name string) error {
+	key, err := t.repo.objectKey(t.modPath, name)
+	if err != nil {
+		return err
+	}
+	return t.repo.deleteObject(t.ctx, t.client, key)
+}
+
+func (t *s3Tree) forbidden(err error) bool {
+	return s3AccessDenied(err)
+}
+
+func (r *S3RepoConfig) putObject(ctx context.Context, client S3Client, key string, asset Asset) error {
+	body, err := asset.Open()
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	input := &s3.PutObjectInput{
+		Bucket:        r.Bucket,
+		Key:           aws.String(key),
+		Body:          body,
+		ContentLength: aws.Int64(asset.Size()),
+		Metadata:      map[string]string{s3SHA256MetadataKey: asset.SHA256()},
+	}
+
+	_, err = client.PutObject(ctx, input)
+	if err != nil {
+		return fmt.Errorf("Error putting S3 object: %v: %w", s3ObjectString(input.Bucket, input.Key), err)
+	}
+	logf("Put S3 object: %v", s3ObjectString(input.Bucket, input.Key))
+
+	return nil
+}
+
+func (r *S3RepoConfig) deleteObject(ctx context.Context, client S3Client, key string) error {
+	input := &s3.DeleteObjectInput{
+		Bucket: r.Bucket,
+		Key:    aws.String(key),
+	}
+
+	_, err := client.DeleteObject(ctx, input)
+	if err != nil {
+		return fmt.Errorf("Error deleting S3 object: %v: %w", s3ObjectString(input.Bucket, input.Key), err)
+	}
+	logf("Deleted S3 object: %v", s3ObjectString(input.Bucket, input.Key))
+
+	return nil
+}
+
+// s3SHA256MetadataKey is the object metadata key of
+// the SHA-256 hash of the object content recorded at put
+const s3SHA256MetadataKey = "sha256"
+
+// objectSHA256 returns the SHA-256 hash of the object recorded in the object
+// metadata, or of the content, and reports false if the object does not exist
+func (r *S3RepoConfig) objectSHA256(ctx context.Context, client S3Client, key string) (string, bool, error) {
+	headInput := &s3.HeadObjectInput{
+		Bucket: r.Bucket,
+		Key:    aws.String(key),
+	}
+
+	headOutput, err := client.HeadObject(ctx, headInput)
+	if s3ObjectMissing(err) && !s3AccessDenied(err) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, fmt.Errorf("Error getting S3 object metadata: %v: %w", s3ObjectString(headInput.Bucket, headInput.Key), err)
+	}
+
+	if hash := headOutput.Metadata[s3SHA256MetadataKey]; hash != "" {
+		return hash, true, nil
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: r.Bucket,
+		Key:    aws.String(key),
+	}
+
+	output, err := client.GetObject(ctx, input)
+	if err != nil {
+		return "", false, fmt.Errorf("Error getting S3 object: %v: %w", s3ObjectString(input.Bucket, input.Key), err)
+	}
+	defer output.Body.Close()
+
+	hash, err := hashReader(output.Body)
+	if err != nil {
+		return "", false, fmt.Errorf("Error reading S3 object: %v: %w", s3ObjectString(input.Bucket, input.Key), err)
+	}
+
+	return hash, true, nil
+}
+
+// s3ObjectMissing reports whether the error is for an object that does not
+// exist. Without the `s3:ListBucket` permission, S3 responds with `Forbidden`
+// instead of `Not Found` for objects that do not exist (see s3AccessDenied).
+func s3ObjectMissing(err error) bool {
+	var noSuchKeyErr *s3Types.NoSuchKey
+	var notFoundErr *s3Types.NotFound
+	var statusErr interface{ HTTPStatusCode() int }
+
+	switch {
+	case errors.As(err, &noSuchKeyErr), errors.As(err, &notFoundErr):
+		return true
+	case errors.As(err, &statusErr):
+		return statusErr.HTTPStatusCode() == http.StatusNotFound || s3AccessDenied(err)
+	}
+	return false
+}
+
+// s3AccessDenied reports whether S3 responded with `Forbidden`,
+// for an object that does not exist or can not be read
+func s3AccessDenied(err error) bool {
+	var statusErr interface{ HTTPStatusCode() int }
+	return errors.As(err, &statusErr) && statusErr.HTTPStatusCode() == http.StatusForbidden
+}
+
+func (r *S3RepoConfig) objectKey(modPath, attifact string) (string, error) {
+	escapedPath, err := module.EscapePath(modPath)
+	if err != nil {
+		return "", fmt.Errorf("Error escaping module path: %v: %w", modPath, err)
+	}
+	return path.Join(r.Prefix, escapedPath, attifact), nil
+}
+
+func (r *S3RepoConfig) getClient(ctx context.Context) (S3Client, error) {
+	if r.client == nil {
+		var optFns []func(*awsconfig.LoadOptions) error
+		if r.Region != "" {
+			optFns = append(optFns, awsconfig.WithRegion(r.Region))
+		}
+
+		config, err := awsconfig.LoadDefaultConfig(ctx, optFns...)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading AWS config: %w", err)
+		}
+
+		r.client = s3.NewFromConfig(config, func(o *s3.Options) {
+			if r.Endpoint != "" {
+				// Custom endpoints are used for S3 compatible
+				// services which often require path style URLs
+				o.BaseEndpoint = aws.String(r.Endpoint)
+			}
+			o.UsePathStyle = r.UsePathStyle
+		})
+	}
+	return r.client, nil
+}
+
+func s3ObjectString(bucket, key *string) string {
+	return fmt.Sprintf("s3://%v/%v", aws.ToString(bucket), aws.ToString(key))
+}
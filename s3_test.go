@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/require"
+)
+
+type MockS3Client struct {
+	Objects  map[string][]byte
+	Metadata map[string]map[string]string
+
+	// Gets are the keys of the objects downloaded
+	Gets []string
+
+	// ListBucketDenied responds with `Forbidden` for objects that do
+	// not exist, as S3 does without the `s3:ListBucket` permission
+	ListBucketDenied bool
+
+	// ReadDenied responds with `Forbidden` for all objects
+	ReadDenied bool
+}
+
+// mockS3StatusError is an S3 error response without a modeled error type
+type mockS3StatusError struct {
+	statusCode int
+}
+
+func (e *mockS3StatusError) Error() string       { return http.StatusText(e.statusCode) }
+func (e *mockS3StatusError) HTTPStatusCode() int { return e.statusCode }
+
+func (c *MockS3Client) missingErr(notFoundErr error) error {
+	if c.ListBucketDenied {
+		return &mockS3StatusError{statusCode: http.StatusForbidden}
+	}
+	return notFoundErr
+}
+
+func (c *MockS3Client) GetObject(
+	ctx context.Context,
+	params *s3.GetObjectInput,
+	optFns ...func(*s3.Options),
+) (*s3.GetObjectOutput, error) {
+	key := aws.ToString(params.Bucket) + "/" + aws.ToString(params.Key)
+	data, ok := c.Objects[key]
+	if c.ReadDenied {
+		return nil, &mockS3StatusError{statusCode: http.StatusForbidden}
+	} else if !ok {
+		return nil, c.missingErr(&s3Types.NoSuchKey{})
+	}
+	c.Gets = append(c.Gets, key)
+	return &s3.GetObjectOutput{
+		Body: io.NopCloser(bytes.NewReader(data)),
+	}, nil
+}
+
+func (c *MockS3Client) HeadObject(
+	ctx context.Context,
+	params *s3.HeadObjectInput,
+	optFns ...func(*s3.Options),
+) (*s3.HeadObjectOutput, error) {
+	key := aws.ToString(params.Bucket) + "/" + aws.ToString(params.Key)
+	if c.ReadDenied {
+		return nil, &mockS3StatusError{statusCode: http.StatusForbidden}
+	} else if _, ok := c.Objects[key]; !ok {
+		return nil, c.missingErr(&s3Types.NotFound{})
+	}
+	return &s3.HeadObjectOutput{
+		Metadata: c.Metadata[key],
+	}, nil
+}
+
+func (c *MockS3Client) PutObject(
+	ctx context.Context,
+	params *s3.PutObjectInput,
+	optFns ...func(*s3.Options),
+) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	key := aws.ToString(params.Bucket) + "/" + aws.ToString(params.Key)
+	c.Objects[key] = data
+	if c.Metadata == nil {
+		c.Metadata = map[string]map[string]string{}
+	}
+	c.Metadata[key] = params.Metadata
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (c *MockS3Client) DeleteObject(
+	ctx context.Context,
+	params *s3.DeleteObjectInput,
+	optFns ...func(*s3.Options),
+) (*s3.DeleteObjectOutput, error) {
+	key := aws.ToString(params.Bucket) + "/" + aws.ToString(params.Key)
+	delete(c.Objects, key)
+	delete(c.Metadata, key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func TestS3PutGet(t *testing.T) {
+	config, err := LoadConfig(strings.NewReader(`{
+		"repos": {
+			"github.com/go-goxm/*": {
+				"type": "s3",
+				"bucket": "TestBucket",
+				"prefix": "goxm/modules",
+				"endpoint": "http://localhost:9000",
+				"use_path_style": true
+			}
+		}
+	}`))
+	require.Nilf(t, err, "Error loading config: %v", err)
+
+	repo := config.Repos["github.com/go-goxm/*"].(*S3RepoConfig)
+	require.Equal(t, "http://localhost:9000", repo.Endpoint)
+	require.True(t, repo.UsePathStyle)
+
+	client := &MockS3Client{Objects: map[string][]byte{}, ListBucketDenied: true}
+	repo.client = client
+
+	goModData := readFile(t, "./testdata/ca_module1_assets/v0.1.0.mod")
+	infoData := readFile(t, "./testdata/ca_module1_assets/v0.1.0.info")
+	zipData := readFile(t, "./testdata/ca_module1_assets/v0.1.0.zip")
+
+	goMod, info, zip := newBytesAsset(goModData), newBytesAsset(infoData), newBytesAsset(zipData)
+	hashes := newBytesAsset([]byte("{}"))
+
+	// Objects that do not exist can not be told apart from objects that
+	// can not be read until another object of the module can be read
+	err = repo.Put(context.Background(), "github.com/go-goxm/Module1", "v0.1.0", goMod, info, zip, hashes, nil, PutOptions{})
+	require.ErrorContains(t, err, "Unable to check existing assets, grant s3:ListBucket or use --force: github.com/go-goxm/Module1@v0.1.0")
+	require.Empty(t, client.Objects)
+
+	err = repo.Put(context.Background(), "github.com/go-goxm/Module1", "v0.1.0", goMod, info, zip, hashes, nil, PutOptions{Force: true})
+	require.Nil(t, err, err)
+
+	err = repo.Put(context.Background(), "github.com/go-goxm/Module1", "v0.2.0", goMod, info, zip, hashes, nil, PutOptions{})
+	require.Nil(t, err, err)
+
+	expectedObjects := map[string][]byte{
+		"TestBucket/goxm/modules/github.com/go-goxm/!module1/@v/list":          []byte("v0.1.0\nv0.2.0\n"),
+		"TestBucket/goxm/modules/github.com/go-goxm/!module1/@v/v0.1.0.hashes": []byte("{}"),
+		"TestBucket/goxm/modules/github.com/go-goxm/!module1/@v/v0.1.0.info":   infoData,
+		"TestBucket/goxm/modules/github.com/go-goxm/!module1/@v/v0.1.0.mod":    goModData,
+		"TestBucket/goxm/modules/github.com/go-goxm/!module1/@v/v0.1.0.zip":    zipData,
+		"TestBucket/goxm/modules/github.com/go-goxm/!module1/@v/v0.2.0.hashes": []byte("{}"),
+		"TestBucket/goxm/modules/github.com/go-goxm/!module1/@v/v0.2.0.info":   infoData,
+		"TestBucket/goxm/modules/github.com/go-goxm/!module1/@v/v0.2.0.mod":    goModData,
+		"TestBucket/goxm/modules/github.com/go-goxm/!module1/@v/v0.2.0.zip":    zipData,
+	}
+	require.Equal(t, expectedObjects, client.Objects)
+
+	// Existing objects are compared by the hash in the metadata
+	// instead of downloading them, except for the version list
+	client.Gets = nil
+	err = repo.Put(context.Background(), "github.com/go-goxm/Module1", "v0.2.0", goMod, info, zip, hashes, nil, PutOptions{})
+	require.Nil(t, err, err)
+	require.Equal(t, []string{"TestBucket/goxm/modules/github.com/go-goxm/!module1/@v/list"}, client.Gets)
+	require.Equal(t, zip.SHA256(), client.Metadata["TestBucket/goxm/modules/github.com/go-goxm/!module1/@v/v0.2.0.zip"][s3SHA256MetadataKey])
+
+	// Objects put without the hash in the metadata are downloaded
+	delete(client.Metadata, "TestBucket/goxm/modules/github.com/go-goxm/!module1/@v/v0.2.0.zip")
+	err = repo.Put(context.Background(), "github.com/go-goxm/Module1", "v0.2.0", goMod, info, newBytesAsset([]byte("changed")), hashes, nil, PutOptions{})
+	require.ErrorContains(t, err, "Version already published with different content: github.com/go-goxm/Module1@v0.2.0: v0.2.0.zip")
+	require.Contains(t, client.Gets, "TestBucket/goxm/modules/github.com/go-goxm/!module1/@v/v0.2.0.zip")
+
+	// Objects that can not be read are not overwritten
+	client.ReadDenied = true
+	err = repo.Put(context.Background(), "github.com/go-goxm/Module1", "v0.1.0", goMod, info, newBytesAsset([]byte("changed")), hashes, nil, PutOptions{})
+	require.ErrorContains(t, err, "Unable to check existing assets, grant s3:ListBucket or use --force: github.com/go-goxm/Module1@v0.1.0")
+	client.ReadDenied = false
+
+	reader, _, err := repo.Get(context.Background(), "github.com/go-goxm/Module1", "@v/v0.1.0.zip")
+	require.Nil(t, err, err)
+
+	data, err := io.ReadAll(reader)
+	require.Nil(t, err)
+	require.Equal(t, zipData, data)
+
+	_, status, err := repo.Get(context.Background(), "github.com/go-goxm/Module1", "@latest")
+	require.Error(t, err)
+	require.Equal(t, http.StatusNotFound, status)
+
+	_, status, err = repo.Get(context.Background(), "github.com/go-goxm/Module1", "@v/v0.3.0.mod")
+	require.Error(t, err)
+	require.Equal(t, http.StatusForbidden, status)
+
+	// The signature of a version replaced without a signature is deleted
+	sigKey := "TestBucket/goxm/modules/github.com/go-goxm/!module1/@v/v0.3.0.sig"
+
+	err = repo.Put(context.Background(), "github.com/go-goxm/Module1", "v0.3.0", goMod, info, zip, hashes, newBytesAsset([]byte("sig")), PutOptions{})
+	require.Nil(t, err, err)
+	require.Contains(t, client.Objects, sigKey)
+
+	err = repo.Put(context.Background(), "github.com/go-goxm/Module1", "v0.3.0", goMod, info, zip, hashes, nil, PutOptions{})
+	require.ErrorContains(t, err, "Version already published with different content: github.com/go-goxm/Module1@v0.3.0: v0.3.0.sig")
+
+	err = repo.Put(context.Background(), "github.com/go-goxm/Module1", "v0.3.0", goMod, info, zip, hashes, nil, PutOptions{Force: true})
+	require.Nil(t, err, err)
+	require.NotContains(t, client.Objects, sigKey)
+}
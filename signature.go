@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/sumdb/note"
+)
+
+// SignatureConfig is the signing configuration of a
+// repository, which is shared by every repository type
+type SignatureConfig struct {
+	SignerKeyFile    string   `json:"signer_key_file"`
+	VerifierKeys     []string `json:"verifier_keys"`
+	VerifySignatures bool     `json:"verify_signatures"`
+}
+
+// Signatures signs the hashes of the versions published to a repository
+// and verifies the signatures of the versions downloaded from it
+type Signatures struct {
+	// SignerKeyFile is the file containing the
+	// signer key used to sign published versions
+	SignerKeyFile string
+
+	// VerifySignatures rejects downloaded versions that are not
+	// signed by one of the verifier keys
+	VerifySignatures bool
+
+	verifiers note.Verifiers
+}
+
+func newSignatures(signatureConfig *SignatureConfig, baseDir string) (*Signatures, error) {
+	signatures := &Signatures{
+		SignerKeyFile:    signatureConfig.SignerKeyFile,
+		VerifySignatures: signatureConfig.VerifySignatures,
+	}
+
+	if signatures.SignerKeyFile != "" && !filepath.IsAbs(signatures.SignerKeyFile) {
+		signatures.SignerKeyFile = filepath.Join(baseDir, signatures.SignerKeyFile)
+	}
+
+	var verifiers []note.Verifier
+	for _, key := range signatureConfig.VerifierKeys {
+		verifier, err := note.NewVerifier(key)
+		if err != nil {
+			return nil, fmt.Errorf("Malformed signature verifier key: %v: %w", key, err)
+		}
+		verifiers = append(verifiers, verifier)
+	}
+	signatures.verifiers = note.VerifierList(verifiers...)
+
+	if signatures.VerifySignatures && len(verifiers) == 0 {
+		return nil, fmt.Errorf("Signature verifier keys not specified")
+	}
+
+	return signatures, nil
+}
+
+// sign returns the `.sig` asset content for the `.hashes` asset content
+func (s *Signatures) sign(hashesData []byte) ([]byte, error) {
+	signerKey, err := os.ReadFile(s.SignerKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading signer key: %w", err)
+	}
+
+	signer, err := note.NewSigner(strings.TrimSpace(string(signerKey)))
+	if err != nil {
+		return nil, fmt.Errorf("Malformed signer key: %v: %w", s.SignerKeyFile, err)
+	}
+
+	sigData, err := note.Sign(&note.Note{Text: string(hashesData)}, signer)
+	if err != nil {
+		return nil, fmt.Errorf("Error signing hashes: %w", err)
+	}
+	return sigData, nil
+}
+
+// open verifies the `.sig` asset content and returns the signed `.hashes` asset content
+func (s *Signatures) open(sigData []byte) ([]byte, error) {
+	signed, err := note.Open(sigData, s.verifiers)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(signed.Text), nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestSignaturesConfig(t *testing.T) {
+	_, verifierKey, err := note.GenerateKey(rand.Reader, "goxm.example.com")
+	require.Nil(t, err, err)
+
+	config, err := loadConfig(strings.NewReader(`{
+		"repos": {
+			"github.com/go-goxm/*": {
+				"type": "filesystem",
+				"path": "repo",
+				"signer_key_file": "signer.key",
+				"verifier_keys": ["`+verifierKey+`"],
+				"verify_signatures": true
+			},
+			"github.com/example/*": {
+				"type": "filesystem",
+				"path": "repo"
+			}
+		}
+	}`), "/etc/goxm")
+	require.Nil(t, err, err)
+
+	signatures := config.Signatures["github.com/go-goxm/*"]
+	require.Equal(t, filepath.FromSlash("/etc/goxm/signer.key"), signatures.SignerKeyFile)
+	require.True(t, signatures.VerifySignatures)
+	require.Nil(t, config.Signatures["github.com/example/*"])
+
+	_, err = LoadConfig(strings.NewReader(`{"repos": {"github.com/go-goxm/*": {"type": "filesystem", "path": "repo", "verify_signatures": true}}}`))
+	require.ErrorContains(t, err, "Signature verifier keys not specified")
+
+	_, err = LoadConfig(strings.NewReader(`{"repos": {"github.com/go-goxm/*": {"type": "filesystem", "path": "repo", "verifier_keys": ["malformed"]}}}`))
+	require.ErrorContains(t, err, "Malformed signature verifier key: malformed")
+}
+
+func TestPublishSigned(t *testing.T) {
+	signerKey, verifierKey, err := note.GenerateKey(rand.Reader, "goxm.example.com")
+	require.Nil(t, err, err)
+
+	otherSignerKey, _, err := note.GenerateKey(rand.Reader, "goxm.example.com")
+	require.Nil(t, err, err)
+
+	keyDir := t.TempDir()
+	require.Nil(t, os.WriteFile(filepath.Join(keyDir, "signer.key"), []byte(signerKey+"\n"), 0o600))
+	require.Nil(t, os.WriteFile(filepath.Join(keyDir, "other.key"), []byte(otherSignerKey+"\n"), 0o600))
+
+	gitDir := gitInit(t)
+
+	gitCommit(t, gitDir, map[string]string{
+		"go.mod":    "module github.com/go-goxm/module1\n\ngo 1.20\n",
+		"module.go": "package module1\n",
+	})
+	git(t, gitDir, "tag", "v0.1.0")
+	git(t, gitDir, "tag", "v0.2.0")
+	git(t, gitDir, "tag", "v0.3.0")
+	git(t, gitDir, "tag", "v0.4.0")
+
+	repoDir := t.TempDir()
+
+	loadRepoConfig := func(signerKeyFile string) *Config {
+		config, err := loadConfig(strings.NewReader(`{
+			"repos": {
+				"github.com/go-goxm/*": {
+					"type": "filesystem",
+					"path": "`+filepath.ToSlash(repoDir)+`",
+					"signer_key_file": "`+signerKeyFile+`",
+					"verifier_keys": ["`+verifierKey+`"],
+					"verify_signatures": true
+				}
+			}
+		}`), keyDir)
+		require.Nil(t, err, err)
+		return config
+	}
+
+	chdir(t, gitDir)
+
+	// Versions are signed when published with a signer key
+	err = runWithConfig(context.Background(), loadRepoConfig("signer.key"), []string{"publish", "v0.1.0"})
+	require.Nil(t, err, err)
+
+	err = runWithConfig(context.Background(), loadRepoConfig(""), []string{"publish", "v0.2.0"})
+	require.Nil(t, err, err)
+
+	err = runWithConfig(context.Background(), loadRepoConfig("other.key"), []string{"publish", "v0.3.0"})
+	require.Nil(t, err, err)
+
+	versionDir := filepath.Join(repoDir, "github.com/go-goxm/module1/@v")
+	require.FileExists(t, filepath.Join(versionDir, "v0.1.0.sig"))
+	require.NoFileExists(t, filepath.Join(versionDir, "v0.2.0.sig"))
+
+	// The signature is a note with the hashes as the text
+	hashesData, err := loadRepoConfig("").Signatures["github.com/go-goxm/*"].open(readFile(t, filepath.Join(versionDir, "v0.1.0.sig")))
+	require.Nil(t, err, err)
+	require.Equal(t, readFile(t, filepath.Join(versionDir, "v0.1.0.hashes")), hashesData)
+
+	// Signed hashes copied from another version are rejected
+	err = runWithConfig(context.Background(), loadRepoConfig("signer.key"), []string{"publish", "v0.4.0"})
+	require.Nil(t, err, err)
+
+	for _, ext := range []string{".sig", ".hashes", ".mod"} {
+		err = os.WriteFile(filepath.Join(versionDir, "v0.4.0"+ext), readFile(t, filepath.Join(versionDir, "v0.1.0"+ext)), 0o644)
+		require.Nil(t, err, err)
+	}
+
+	server := httptest.NewServer(newProxyHandler(loadRepoConfig("")))
+	defer server.Close()
+
+	// Unsigned and wrongly signed versions are rejected
+	expectedResponses := map[string]int{
+		"/github.com/go-goxm/module1/@v/v0.1.0.info": http.StatusOK,
+		"/github.com/go-goxm/module1/@v/v0.1.0.mod":  http.StatusOK,
+		"/github.com/go-goxm/module1/@v/v0.1.0.zip":  http.StatusOK,
+		"/github.com/go-goxm/module1/@v/v0.2.0.mod":  http.StatusForbidden,
+		"/github.com/go-goxm/module1/@v/v0.3.0.mod":  http.StatusForbidden,
+		"/github.com/go-goxm/module1/@v/v0.4.0.mod":  http.StatusForbidden,
+		"/github.com/go-goxm/module1/@v/list":        http.StatusOK,
+	}
+
+	for requestPath, expectedStatus := range expectedResponses {
+		resp, err := http.Get(server.URL + requestPath)
+		require.Nil(t, err, err)
+		resp.Body.Close()
+		require.Equal(t, expectedStatus, resp.StatusCode, requestPath)
+	}
+
+	// The signature must be removed when forcing an unsigned version
+	err = runWithConfig(context.Background(), loadRepoConfig(""), []string{"publish", "v0.1.0"})
+	require.ErrorContains(t, err, "Version already published with different content: github.com/go-goxm/module1@v0.1.0: v0.1.0.sig")
+
+	err = runWithConfig(context.Background(), loadRepoConfig(""), []string{"publish", "--force", "v0.1.0"})
+	require.Nil(t, err, err)
+	require.NoFileExists(t, filepath.Join(versionDir, "v0.1.0.sig"))
+}
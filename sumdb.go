@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+type SumDBConfig struct {
+	Name          string `json:"name"`
+	Key           string `json:"key"`
+	SignerKeyFile string `json:"signer_key_file"`
+	Dir           string `json:"dir"`
+}
+
+// SumDB is a private checksum database of the published modules,
+// stored as a transparent log and served like `sum.golang.org`
+type SumDB struct {
+	Name string
+	Dir  string
+
+	// Key is the verifier key used by the go command in GOSUMDB
+	Key string
+
+	// SignerKeyFile is the file containing the signer key,
+	// unless it is set with the GOXM_SUMDB_SIGNER_KEY environment variable
+	SignerKeyFile string
+
+	verifier note.Verifier
+}
+
+const sumDBSignerKeyEnv = "GOXM_SUMDB_SIGNER_KEY"
+
+func newSumDB(sumDBConfig *SumDBConfig, baseDir string) (*SumDB, error) {
+	if sumDBConfig.Name == "" {
+		return nil, fmt.Errorf("Checksum database name not specified")
+	}
+	if sumDBConfig.Dir == "" {
+		return nil, fmt.Errorf("Checksum database directory not specified: %v", sumDBConfig.Name)
+	}
+
+	verifier, err := note.NewVerifier(sumDBConfig.Key)
+	if err != nil {
+		return nil, fmt.Errorf("Malformed checksum database key: %v: %w", sumDBConfig.Name, err)
+	}
+	if verifier.Name() != sumDBConfig.Name {
+		return nil, fmt.Errorf("Checksum database key name does not match: %v != %v", verifier.Name(), sumDBConfig.Name)
+	}
+
+	sumDB := &SumDB{
+		Name:          sumDBConfig.Name,
+		Dir:           sumDBConfig.Dir,
+		Key:           sumDBConfig.Key,
+		SignerKeyFile: sumDBConfig.SignerKeyFile,
+		verifier:      verifier,
+	}
+
+	if !filepath.IsAbs(sumDB.Dir) {
+		sumDB.Dir = filepath.Join(baseDir, sumDB.Dir)
+	}
+	if sumDB.SignerKeyFile != "" && !filepath.IsAbs(sumDB.SignerKeyFile) {
+		sumDB.SignerKeyFile = filepath.Join(baseDir, sumDB.SignerKeyFile)
+	}
+
+	return sumDB, nil
+}
+
+// generateKeys prints a new signer and verifier key pair for a checksum database
+func generateKeys(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("Unsupported arguments: Usage: goxm keygen <name>")
+	}
+
+	signerKey, verifierKey, err := note.GenerateKey(rand.Reader, args[0])
+	if err != nil {
+		return fmt.Errorf("Error generating key: %w", err)
+	}
+
+	fmt.Printf("Verifier key: %v\nSigner key: %v\n", verifierKey, signerKey)
+	return nil
+}
+
+// ServeHTTP serves the checksum database under `/sumdb/<name>/`,
+// where the go command looks for it when using a proxy
+func (db *SumDB) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	path, ok := strings.CutPrefix(req.URL.Path, "/sumdb/"+db.Name)
+	if !ok {
+		resp.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if path == "/supported" {
+		resp.WriteHeader(http.StatusOK)
+		return
+	}
+
+	http.StripPrefix("/sumdb/"+db.Name, sumdb.NewServer(db)).ServeHTTP(resp, req)
+}
+
+// goSumLines returns the go.sum lines recorded for a module version
+func goSumLines(modPath, version, zipHash, goModHash string) string {
+	return fmt.Sprintf("%v %v %v\n%v %v/go.mod %v\n", modPath, version, zipHash, modPath, version, goModHash)
+}
+
+// Check returns an error if the module version is
+// recorded in the database with different hashes
+func (db *SumDB) Check(modPath, version, zipHash, goModHash string) error {
+	_, err := db.check(modPath, version, goSumLines(modPath, version, zipHash, goModHash))
+	return err
+}
+
+func (db *SumDB) check(modPath, version, record string) (bool, error) {
+	tree, err := db.readTree()
+	if err != nil {
+		return false, err
+	}
+
+	id, err := db.lookup(module.Version{Path: modPath, Version: version}, tree)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	records, err := db.readRecords(id, 1)
+	if err != nil {
+		return false, err
+	}
+
+	if string(records[0]) != record {
+		return false, fmt.Errorf("Version recorded in checksum database with different hashes: %v@%v (the checksum database can not be changed)", modPath, version)
+	}
+	return true, nil
+}
+
+// Add records the hashes of a module version in the database and signs
+// the new tree head, which is written last in case the add is interrupted
+func (db *SumDB) Add(modPath, version, zipHash, goModHash string) error {
+	record := goSumLines(modPath, version, zipHash, goModHash)
+
+	recorded, err := db.check(modPath, version, record)
+	if err != nil || recorded {
+		return err
+	}
+
+	signer, err := db.signer()
+	if err != nil {
+		return err
+	}
+
+	tree, err := db.readTree()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Join(db.Dir, "records"), 0o755)
+	if err != nil {
+		return fmt.Errorf("Error creating checksum database directory: %w", err)
+	}
+
+	hashesFile, err := os.OpenFile(filepath.Join(db.Dir, "hashes"), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("Error opening checksum database hashes: %w", err)
+	}
+	defer hashesFile.Close()
+
+	// Discard any hashes appended by an interrupted add
+	hashesSize := tlog.StoredHashCount(tree.N) * tlog.HashSize
+	err = hashesFile.Truncate(hashesSize)
+	if err != nil {
+		return fmt.Errorf("Error truncating checksum database hashes: %w", err)
+	}
+
+	hashes, err := tlog.StoredHashes(tree.N, []byte(record), tlogHashReader(hashesFile))
+	if err != nil {
+		return fmt.Errorf("Error hashing checksum database record: %w", err)
+	}
+
+	for i, hash := range hashes {
+		_, err = hashesFile.WriteAt(hash[:], hashesSize+int64(i)*tlog.HashSize)
+		if err != nil {
+			return fmt.Errorf("Error writing checksum database hashes: %w", err)
+		}
+	}
+
+	err = hashesFile.Sync()
+	if err != nil {
+		return fmt.Errorf("Error writing checksum database hashes: %w", err)
+	}
+
+	err = writeFileAtomic(db.recordPath(tree.N), []byte(record))
+	if err != nil {
+		return fmt.Errorf("Error writing checksum database record: %w", err)
+	}
+
+	lookupPath, err := db.lookupPath(module.Version{Path: modPath, Version: version})
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(lookupPath), 0o755)
+	if err != nil {
+		return fmt.Errorf("Error creating checksum database directory: %w", err)
+	}
+
+	err = writeFileAtomic(lookupPath, []byte(strconv.FormatInt(tree.N, 10)))
+	if err != nil {
+		return fmt.Errorf("Error writing checksum database lookup: %w", err)
+	}
+
+	treeHash, err := tlog.TreeHash(tree.N+1, tlogHashReader(hashesFile))
+	if err != nil {
+		return fmt.Errorf("Error hashing checksum database tree: %w", err)
+	}
+
+	signed, err := note.Sign(&note.Note{Text: string(tlog.FormatTree(tlog.Tree{N: tree.N + 1, Hash: treeHash}))}, signer)
+	if err != nil {
+		return fmt.Errorf("Error signing checksum database tree: %w", err)
+	}
+
+	err = writeFileAtomic(filepath.Join(db.Dir, "latest"), signed)
+	if err != nil {
+		return fmt.Errorf("Error writing checksum database tree: %w", err)
+	}
+
+	logf("Recorded module in checksum database: %v@%v", modPath, version)
+	return nil
+}
+
+// signer loads the signer key and checks that it matches the verifier key
+func (db *SumDB) signer() (note.Signer, error) {
+	signerKey := os.Getenv(sumDBSignerKeyEnv)
+	if signerKey == "" && db.SignerKeyFile != "" {
+		data, err := os.ReadFile(db.SignerKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading checksum database signer key: %w", err)
+		}
+		signerKey = strings.TrimSpace(string(data))
+	}
+	if signerKey == "" {
+		return nil, fmt.Errorf("Checksum database signer key not specified: set %v or signer_key_file", sumDBSignerKeyEnv)
+	}
+
+	signer, err := note.NewSigner(signerKey)
+	if err != nil {
+		return nil, fmt.Errorf("Malformed checksum database signer key: %w", err)
+	}
+	if signer.Name() != db.verifier.Name() || signer.KeyHash() != db.verifier.KeyHash() {
+		return nil, fmt.Errorf("Checksum database signer key does not match key: %v", db.Key)
+	}
+	return signer, nil
+}
+
+// readTree returns the verified tree head, or an empty tree if no records are added
+func (db *SumDB) readTree() (tlog.Tree, error) {
+	signed, err := os.ReadFile(filepath.Join(db.Dir, "latest"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return tlog.Tree{}, nil
+	} else if err != nil {
+		return tlog.Tree{}, fmt.Errorf("Error reading checksum database tree: %w", err)
+	}
+
+	treeNote, err := note.Open(signed, note.VerifierList(db.verifier))
+	if err != nil {
+		return tlog.Tree{}, fmt.Errorf("Error verifying checksum database tree: %w", err)
+	}
+
+	tree, err := tlog.ParseTree([]byte(treeNote.Text))
+	if err != nil {
+		return tlog.Tree{}, fmt.Errorf("Malformed checksum database tree: %w", err)
+	}
+	return tree, nil
+}
+
+// lookup returns the record ID of a module version in the tree
+func (db *SumDB) lookup(m module.Version, tree tlog.Tree) (int64, error) {
+	lookupPath, err := db.lookupPath(m)
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := os.ReadFile(lookupPath)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Malformed checksum database lookup: %v: %w", lookupPath, err)
+	}
+
+	// Records left by an interrupted add are not part of the tree
+	if id >= tree.N {
+		return 0, &fs.PathError{Op: "lookup", Path: m.String(), Err: fs.ErrNotExist}
+	}
+	return id, nil
+}
+
+func (db *SumDB) lookupPath(m module.Version) (string, error) {
+	escapedPath, err := module.EscapePath(m.Path)
+	if err != nil {
+		return "", err
+	}
+
+	escapedVersion, err := module.EscapeVersion(m.Version)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(db.Dir, "lookup", filepath.FromSlash(escapedPath), "@v", escapedVersion), nil
+}
+
+func (db *SumDB) recordPath(id int64) string {
+	return filepath.Join(db.Dir, "records", strconv.FormatInt(id, 10))
+}
+
+func (db *SumDB) readRecords(id, n int64) ([][]byte, error) {
+	var records [][]byte
+	for i := id; i < id+n; i++ {
+		record, err := os.ReadFile(db.recordPath(i))
+		if err != nil {
+			return nil, fmt.Errorf("Error reading checksum database record: %w", err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// tlogHashReader reads the stored hashes of the log from the hashes file
+func tlogHashReader(file io.ReaderAt) tlog.HashReaderFunc {
+	return func(indexes []int64) ([]tlog.Hash, error) {
+		hashes := make([]tlog.Hash, len(indexes))
+		for i, index := range indexes {
+			_, err := file.ReadAt(hashes[i][:], index*tlog.HashSize)
+			if err != nil {
+				return nil, fmt.Errorf("Error reading checksum database hashes: %w", err)
+			}
+		}
+		return hashes, nil
+	}
+}
+
+// Signed implements sumdb.ServerOps
+func (db *SumDB) Signed(ctx context.Context) ([]byte, error) {
+	return os.ReadFile(filepath.Join(db.Dir, "latest"))
+}
+
+// ReadRecords implements sumdb.ServerOps
+func (db *SumDB) ReadRecords(ctx context.Context, id, n int64) ([][]byte, error) {
+	return db.readRecords(id, n)
+}
+
+// Lookup implements sumdb.ServerOps
+func (db *SumDB) Lookup(ctx context.Context, m module.Version) (int64, error) {
+	tree, err := db.readTree()
+	if err != nil {
+		return 0, err
+	}
+	return db.lookup(m, tree)
+}
+
+// ReadTileData implements sumdb.ServerOps
+func (db *SumDB) ReadTileData(ctx context.Context, t tlog.Tile) ([]byte, error) {
+	hashesFile, err := os.Open(filepath.Join(db.Dir, "hashes"))
+	if err != nil {
+		return nil, err
+	}
+	defer hashesFile.Close()
+
+	return tlog.ReadTileData(t, tlogHashReader(hashesFile))
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/rand"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func newTestSumDB(t *testing.T) (*SumDB, string) {
+	signerKey, verifierKey, err := note.GenerateKey(rand.Reader, "sum.example.com")
+	require.Nil(t, err, err)
+
+	sumDB, err := newSumDB(&SumDBConfig{Name: "sum.example.com", Key: verifierKey, Dir: t.TempDir()}, "")
+	require.Nil(t, err, err)
+
+	return sumDB, signerKey
+}
+
+func TestSumDB(t *testing.T) {
+	sumDB, signerKey := newTestSumDB(t)
+	t.Setenv(sumDBSignerKeyEnv, "")
+
+	err := sumDB.Add("github.com/go-goxm/module1", "v0.1.0", "h1:zip1=", "h1:mod1=")
+	require.ErrorContains(t, err, "Checksum database signer key not specified")
+
+	otherSignerKey, _, err := note.GenerateKey(rand.Reader, "sum.example.com")
+	require.Nil(t, err, err)
+	t.Setenv(sumDBSignerKeyEnv, otherSignerKey)
+
+	err = sumDB.Add("github.com/go-goxm/module1", "v0.1.0", "h1:zip1=", "h1:mod1=")
+	require.ErrorContains(t, err, "Checksum database signer key does not match key")
+
+	t.Setenv(sumDBSignerKeyEnv, signerKey)
+
+	err = sumDB.Add("github.com/go-goxm/module1", "v0.1.0", "h1:zip1=", "h1:mod1=")
+	require.Nil(t, err, err)
+
+	err = sumDB.Add("github.com/go-goxm/Module2", "v0.2.0", "h1:zip2=", "h1:mod2=")
+	require.Nil(t, err, err)
+
+	// Adding identical hashes again does not add a record
+	err = sumDB.Add("github.com/go-goxm/module1", "v0.1.0", "h1:zip1=", "h1:mod1=")
+	require.Nil(t, err, err)
+
+	tree, err := sumDB.readTree()
+	require.Nil(t, err, err)
+	require.Equal(t, int64(2), tree.N)
+
+	err = sumDB.Check("github.com/go-goxm/module1", "v0.1.0", "h1:zip3=", "h1:mod1=")
+	require.ErrorContains(t, err, "Version recorded in checksum database with different hashes: github.com/go-goxm/module1@v0.1.0")
+
+	err = sumDB.Add("github.com/go-goxm/module1", "v0.1.0", "h1:zip3=", "h1:mod1=")
+	require.ErrorContains(t, err, "Version recorded in checksum database with different hashes")
+
+	// Records left by an interrupted add are not part of the tree
+	lookupPath, err := sumDB.lookupPath(module.Version{Path: "github.com/go-goxm/module1", Version: "v0.3.0"})
+	require.Nil(t, err, err)
+	require.Nil(t, os.MkdirAll(filepath.Dir(lookupPath), 0o755))
+	require.Nil(t, os.WriteFile(lookupPath, []byte("2"), 0o644))
+	require.Nil(t, os.WriteFile(sumDB.recordPath(2), []byte("interrupted\n"), 0o644))
+
+	server := httptest.NewServer(sumDB)
+	defer server.Close()
+
+	expectedResponses := map[string]int{
+		"/sumdb/sum.example.com/supported":                                     http.StatusOK,
+		"/sumdb/sum.example.com/latest":                                        http.StatusOK,
+		"/sumdb/sum.example.com/lookup/github.com/go-goxm/module1@v0.1.0":      http.StatusOK,
+		"/sumdb/sum.example.com/lookup/github.com/go-goxm/!module2@v0.2.0":     http.StatusOK,
+		"/sumdb/sum.example.com/lookup/github.com/go-goxm/module1@v0.3.0":      http.StatusNotFound,
+		"/sumdb/sum.example.com/lookup/github.com/go-goxm/module1@v0.4.0":      http.StatusNotFound,
+		"/sumdb/sum.example.com/tile/8/0/000.p/2":                              http.StatusOK,
+		"/sumdb/sum.golang.org/lookup/github.com/go-goxm/module1@v0.1.0":       http.StatusNotFound,
+		"/sumdb/sum.example.com.evil/lookup/github.com/go-goxm/module1@v0.1.0": http.StatusNotFound,
+	}
+
+	for requestPath, expectedStatus := range expectedResponses {
+		resp, err := http.Get(server.URL + requestPath)
+		require.Nil(t, err, err)
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.Nil(t, err, err)
+		require.Equal(t, expectedStatus, resp.StatusCode, requestPath)
+
+		if requestPath == "/sumdb/sum.example.com/lookup/github.com/go-goxm/module1@v0.1.0" {
+			require.Contains(t, string(data), "github.com/go-goxm/module1 v0.1.0 h1:zip1=\ngithub.com/go-goxm/module1 v0.1.0/go.mod h1:mod1=\n")
+		}
+	}
+
+	err = sumDB.Add("github.com/go-goxm/module1", "v0.3.0", "h1:zip3=", "h1:mod3=")
+	require.Nil(t, err, err)
+
+	records, err := sumDB.readRecords(2, 1)
+	require.Nil(t, err, err)
+	require.Equal(t, "github.com/go-goxm/module1 v0.3.0 h1:zip3=\ngithub.com/go-goxm/module1 v0.3.0/go.mod h1:mod3=\n", string(records[0]))
+
+	tree, err = sumDB.readTree()
+	require.Nil(t, err, err)
+	require.Equal(t, int64(3), tree.N)
+}
+
+func TestSumDBConfig(t *testing.T) {
+	_, verifierKey, err := note.GenerateKey(rand.Reader, "sum.example.com")
+	require.Nil(t, err, err)
+
+	sumDB, err := newSumDB(&SumDBConfig{
+		Name:          "sum.example.com",
+		Key:           verifierKey,
+		Dir:           "sumdb",
+		SignerKeyFile: "sumdb.key",
+	}, "/etc/goxm")
+	require.Nil(t, err, err)
+	require.Equal(t, filepath.FromSlash("/etc/goxm/sumdb"), sumDB.Dir)
+	require.Equal(t, filepath.FromSlash("/etc/goxm/sumdb.key"), sumDB.SignerKeyFile)
+
+	_, err = newSumDB(&SumDBConfig{Name: "sum.example.org", Key: verifierKey, Dir: "sumdb"}, "")
+	require.ErrorContains(t, err, "Checksum database key name does not match: sum.example.com != sum.example.org")
+
+	_, err = newSumDB(&SumDBConfig{Name: "sum.example.com", Key: "malformed", Dir: "sumdb"}, "")
+	require.ErrorContains(t, err, "Malformed checksum database key")
+
+	_, err = newSumDB(&SumDBConfig{Name: "sum.example.com", Key: verifierKey}, "")
+	require.ErrorContains(t, err, "Checksum database directory not specified")
+}
@@ -1,24 +1,50 @@
 package main
 
 import (
+	archivezip "archive/zip"
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	codeartifactTypes "github.com/aws/aws-sdk-go-v2/service/codeartifact/types"
+	"golang.org/x/exp/slices"
 	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"golang.org/x/mod/zip"
 )
 
 type Info struct {
 	Version string    // version string
 	Time    time.Time // commit time
+	Origin  *Origin   `json:",omitempty"` // provenance of module
+}
+
+// Origin describes the provenance of a module version,
+// in the same format as the go command (Go 1.19 and later)
+type Origin struct {
+	VCS    string `json:",omitempty"` // "git"
+	URL    string `json:",omitempty"` // URL of repository
+	Subdir string `json:",omitempty"` // sub directory in repository
+	Hash   string `json:",omitempty"` // commit hash
+	Ref    string `json:",omitempty"` // "refs/tags/v1.2.3"
 }
 
 func logf(format string, args ...any) {
@@ -28,34 +54,142 @@ func logf(format string, args ...any) {
 	fmt.Fprintf(os.Stderr, "GOXM: "+format, args...)
 }
 
-func getGoInfoFromGit(ctx context.Context, version string) ([]byte, string, error) {
+func getGitRootPath(ctx context.Context) (string, error) {
 
 	gitRootPath, err := exec.CommandContext(ctx, "git", "rev-parse", "--show-toplevel").Output()
 	if err != nil {
-		return nil, "", fmt.Errorf("Current directory is not in a Git repository: %w", err)
+		return "", fmt.Errorf("Current directory is not in a Git repository: %w", err)
 	}
 
-	gitCommitTime, err := exec.CommandContext(ctx, "git", "log", "--max-count=1", "--format=%ct", version).Output()
+	return string(bytes.TrimSpace(gitRootPath)), nil
+}
+
+func getGoInfoFromGit(ctx context.Context, gitRootPath, revision, commit, subDir, version string) ([]byte, error) {
+
+	gitCommitTime, err := getGitCommitTime(ctx, gitRootPath, commit)
 	if err != nil {
-		return nil, "", fmt.Errorf("Git revision not found: %s: %w", version, err)
+		return nil, err
 	}
 
-	gitCommitTimeInt64, err := strconv.ParseInt(string(bytes.TrimSpace(gitCommitTime)), 0, 64)
+	gitOrigin, err := getGitOrigin(ctx, gitRootPath, revision, commit, subDir)
 	if err != nil {
-		return nil, "", fmt.Errorf("%w", err)
+		return nil, err
 	}
 
 	gitVersionInfo := Info{
 		Version: version,
-		Time:    time.Unix(gitCommitTimeInt64, 0).UTC(),
+		Time:    gitCommitTime,
+		Origin:  gitOrigin,
 	}
 
 	gitVersionInfoJSON, err := json.MarshalIndent(gitVersionInfo, "", "    ")
 	if err != nil {
-		return nil, "", err
+		return nil, err
+	}
+
+	return gitVersionInfoJSON, nil
+}
+
+// getGitCommitTime returns the commit time of the revision, which is
+// also the time used in pseudo-versions
+func getGitCommitTime(ctx context.Context, gitRootPath, revision string) (time.Time, error) {
+
+	cmd := exec.CommandContext(ctx, "git", "log", "--max-count=1", "--format=%ct", revision)
+	cmd.Dir = gitRootPath
+
+	gitCommitTime, err := cmd.Output()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Git revision not found: %s: %w", revision, err)
+	}
+
+	gitCommitTimeInt64, err := strconv.ParseInt(string(bytes.TrimSpace(gitCommitTime)), 0, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w", err)
+	}
+
+	return time.Unix(gitCommitTimeInt64, 0).UTC(), nil
+}
+
+// resolveGitCommit returns the commit hash of the Git revision
+func resolveGitCommit(ctx context.Context, gitRootPath, revision string) (string, error) {
+
+	cmd := exec.CommandContext(ctx, "git", "rev-parse", "--verify", "--quiet", revision+"^{commit}")
+	cmd.Dir = gitRootPath
+
+	hash, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("Git revision not found or not a commit: %v", revision)
+	}
+
+	return string(bytes.TrimSpace(hash)), nil
+}
+
+// getGitOrigin returns the commit hash and the full name of the revision,
+// such as `refs/tags/v1.2.3`, and the URL of the `origin` remote if configured
+func getGitOrigin(ctx context.Context, gitRootPath, revision, commit, subDir string) (*Origin, error) {
+
+	origin := &Origin{
+		VCS:    "git",
+		Subdir: subDir,
+		Hash:   commit,
+	}
+
+	// Commit hashes and `HEAD` do not have a full name
+	cmd := exec.CommandContext(ctx, "git", "rev-parse", "--symbolic-full-name", revision)
+	cmd.Dir = gitRootPath
+
+	ref, err := cmd.Output()
+	if err == nil && bytes.HasPrefix(ref, []byte("refs/")) {
+		origin.Ref = string(bytes.TrimSpace(ref))
+	}
+
+	cmd = exec.CommandContext(ctx, "git", "remote", "get-url", "origin")
+	cmd.Dir = gitRootPath
+
+	remoteURL, err := cmd.Output()
+	if err == nil {
+		origin.URL = string(bytes.TrimSpace(remoteURL))
+
+		// Credentials in the remote URL must not be published
+		if u, err := url.Parse(origin.URL); err == nil && u.User != nil && u.Scheme != "" {
+			u.User = nil
+			origin.URL = u.String()
+		}
+	}
+
+	return origin, nil
+}
+
+// getGoModuleFromGit reads the go.mod file in the sub directory
+// of the Git repository at the revision, rather than from the working tree
+func getGoModuleFromGit(ctx context.Context, gitRootPath, revision, subDir string) (string, []byte, error) {
+
+	goModFilePath := path.Join(subDir, "go.mod")
+
+	cmd := exec.CommandContext(ctx, "git", "show", revision+":"+goModFilePath)
+	cmd.Dir = gitRootPath
+
+	goModData, err := cmd.Output()
+	if err != nil {
+		return "", nil, fmt.Errorf("Go module file (go.mod) not found at Git revision: %v:%v: %w", revision, goModFilePath, err)
+	}
+
+	goMod, err := modfile.ParseLax(goModFilePath, goModData, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("Go module file (go.mod) could not be parsed: %v:%v: %w", revision, goModFilePath, err)
+	}
+
+	if goMod.Module == nil || goMod.Module.Mod.Path == "" {
+		return "", nil, fmt.Errorf("Go module name not found: %v:%v", revision, goModFilePath)
+	}
+
+	goModName := goMod.Module.Mod.Path
+	err = module.CheckPath(goModName)
+	if err != nil {
+		return "", nil, fmt.Errorf("Go module name is not valid: %v:%v: %w", revision, goModFilePath, err)
 	}
 
-	return gitVersionInfoJSON, string(bytes.TrimSpace(gitRootPath)), nil
+	return goModName, goModData, nil
 }
 
 func getGoModule(ctx context.Context) (string, []byte, string, error) {
@@ -82,10 +216,545 @@ func getGoModule(ctx context.Context) (string, []byte, string, error) {
 		return "", nil, "", fmt.Errorf("Go module file (go.mod) could not be parsed")
 	}
 
-	goModName := goMod.Module.Mod.Path
-	if goModName == "" {
+	if goMod.Module == nil || goMod.Module.Mod.Path == "" {
 		return "", nil, "", fmt.Errorf("Go module name not found")
 	}
+	goModName := goMod.Module.Mod.Path
 
 	return goModName, goModData, goModFilePath, nil
 }
+
+// gitArchiveFiles returns the files in the sub directory of the Git repository
+// at the revision and a function to release them
+func gitArchiveFiles(ctx context.Context, gitRootPath, revision, subDir string) ([]zip.File, func(), error) {
+
+	archiveFile, err := os.CreateTemp("", "goxm-archive-*.zip")
+	if err != nil {
+		return nil, nil, err
+	}
+	archiveFile.Close()
+
+	// The line ending settings match the go command so that
+	// the archive is the same on every operating system
+	cmd := exec.CommandContext(ctx, "git", "-c", "core.autocrlf=input", "-c", "core.eol=lf",
+		"archive", "--format=zip", "--output="+archiveFile.Name(), revision)
+	if subDir != "" {
+		cmd.Args = append(cmd.Args, subDir)
+	}
+	cmd.Dir = gitRootPath
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		os.Remove(archiveFile.Name())
+		return nil, nil, fmt.Errorf("Error running git archive: %v: %w: %s", revision, err, bytes.TrimSpace(output))
+	}
+
+	archiveReader, err := archivezip.OpenReader(archiveFile.Name())
+	if err != nil {
+		os.Remove(archiveFile.Name())
+		return nil, nil, err
+	}
+
+	release := func() {
+		archiveReader.Close()
+		os.Remove(archiveFile.Name())
+	}
+
+	haveLICENSE := false
+	var files []zip.File
+	for _, f := range archiveReader.File {
+		name := f.Name
+		if subDir != "" {
+			var ok bool
+			name, ok = strings.CutPrefix(name, subDir+"/")
+			if !ok {
+				continue
+			}
+		}
+		if name == "" || strings.HasSuffix(name, "/") {
+			continue
+		}
+
+		files = append(files, gitArchiveFile{name: name, f: f})
+		if name == "LICENSE" {
+			haveLICENSE = true
+		}
+	}
+
+	// Modules in a sub directory include the LICENSE file
+	// from the root of the repository, like the go command
+	if !haveLICENSE && subDir != "" {
+		cmd := exec.CommandContext(ctx, "git", "cat-file", "blob", revision+":LICENSE")
+		cmd.Dir = gitRootPath
+		if licenseData, err := cmd.Output(); err == nil {
+			files = append(files, gitDataFile{name: "LICENSE", data: licenseData})
+		}
+	}
+
+	return files, release, nil
+}
+
+type gitArchiveFile struct {
+	name string
+	f    *archivezip.File
+}
+
+func (f gitArchiveFile) Path() string                 { return f.name }
+func (f gitArchiveFile) Lstat() (os.FileInfo, error)  { return f.f.FileInfo(), nil }
+func (f gitArchiveFile) Open() (io.ReadCloser, error) { return f.f.Open() }
+
+type gitDataFile struct {
+	name string
+	data []byte
+}
+
+func (f gitDataFile) Path() string                 { return f.name }
+func (f gitDataFile) Lstat() (os.FileInfo, error)  { return gitDataFileInfo{f}, nil }
+func (f gitDataFile) Open() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(f.data)), nil }
+
+type gitDataFileInfo struct {
+	f gitDataFile
+}
+
+func (fi gitDataFileInfo) Name() string       { return path.Base(fi.f.name) }
+func (fi gitDataFileInfo) Size() int64        { return int64(len(fi.f.data)) }
+func (fi gitDataFileInfo) Mode() os.FileMode  { return 0o644 }
+func (fi gitDataFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi gitDataFileInfo) IsDir() bool        { return false }
+func (fi gitDataFileInfo) Sys() any           { return nil }
+
+// assetNotFoundError wraps a repository error for an asset that does not exist
+type assetNotFoundError struct {
+	error
+}
+
+func (e assetNotFoundError) Unwrap() error { return e.error }
+
+// isAssetNotFound reports whether the error getting an asset from a
+// repository is because the asset does not exist, as opposed to an
+// error accessing the repository
+func isAssetNotFound(err error) bool {
+	var caNotFoundErr *codeartifactTypes.ResourceNotFoundException
+	var goProxyErr *goProxyStatusError
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return true
+	case errors.As(err, &caNotFoundErr):
+		return true
+	case errors.As(err, &assetNotFoundError{}):
+		return true
+	case errors.As(err, &goProxyErr):
+		return goProxyErr.StatusCode == http.StatusNotFound || goProxyErr.StatusCode == http.StatusGone
+	}
+	return false
+}
+
+// isRepositoryUnavailable reports whether the error getting an asset from
+// a repository is a network error, a server error or throttling
+func isRepositoryUnavailable(err error) bool {
+	var goProxyErr *goProxyStatusError
+	var statusErr interface{ HTTPStatusCode() int }
+	var netErr net.Error
+
+	switch {
+	case errors.As(err, &goProxyErr):
+		return goProxyErr.StatusCode >= http.StatusInternalServerError || goProxyErr.StatusCode == http.StatusTooManyRequests
+	case errors.As(err, &statusErr):
+		return statusErr.HTTPStatusCode() >= http.StatusInternalServerError || statusErr.HTTPStatusCode() == http.StatusTooManyRequests
+	case errors.As(err, &netErr):
+		return true
+	}
+	return false
+}
+
+func writeFileAtomic(name string, data []byte) error {
+	return writeReaderAtomic(name, bytes.NewReader(data))
+}
+
+func writeReaderAtomic(name string, reader io.Reader) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	_, err = io.Copy(tmpFile, reader)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(tmpFile.Name(), 0o644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), name)
+}
+
+type bytesAsset struct {
+	data   []byte
+	sha256 string
+}
+
+func newBytesAsset(data []byte) Asset {
+	return &bytesAsset{
+		data:   data,
+		sha256: fmt.Sprintf("%x", sha256.Sum256(data)),
+	}
+}
+
+func (a *bytesAsset) Open() (io.ReadSeekCloser, error) {
+	return readSeekNopCloser{bytes.NewReader(a.data)}, nil
+}
+func (a *bytesAsset) Size() int64    { return int64(len(a.data)) }
+func (a *bytesAsset) SHA256() string { return a.sha256 }
+
+type readSeekNopCloser struct {
+	io.ReadSeeker
+}
+
+func (readSeekNopCloser) Close() error { return nil }
+
+// fileAsset is an asset spooled to a temporary file
+type fileAsset struct {
+	name   string
+	size   int64
+	sha256 string
+}
+
+// newFileAsset writes the content to a temporary file, computing the size
+// and hash as it is written. The file must be removed with `Remove`.
+func newFileAsset(pattern string, write func(w io.Writer) error) (*fileAsset, error) {
+	file, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	counter := &countWriter{}
+	err = write(io.MultiWriter(file, hash, counter))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	return &fileAsset{
+		name:   file.Name(),
+		size:   counter.n,
+		sha256: fmt.Sprintf("%x", hash.Sum(nil)),
+	}, nil
+}
+
+func (a *fileAsset) Open() (io.ReadSeekCloser, error) {
+	file, err := os.Open(a.name)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (a *fileAsset) Size() int64    { return a.size }
+func (a *fileAsset) SHA256() string { return a.sha256 }
+func (a *fileAsset) Remove() error  { return os.Remove(a.name) }
+
+type countWriter struct {
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// hashReader returns the hex encoded SHA-256 hash of the content
+func hashReader(reader io.Reader) (string, error) {
+	hash := sha256.New()
+	_, err := io.Copy(hash, reader)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// assetExtensions are the extensions of the versioned assets stored in repositories
+var assetExtensions = []string{".info", ".mod", ".zip", ".hashes", ".sig"}
+
+type versionState int
+
+const (
+	// versionNotPublished has no existing assets
+	versionNotPublished versionState = iota
+	// versionPublished has all of the assets with identical content
+	versionPublished
+	// versionUnfinished has some of the assets, with identical content,
+	// from an interrupted publish that is resumed
+	versionUnfinished
+	// versionReplaced has existing assets that are replaced
+	versionReplaced
+)
+
+// checkExistingAssets compares the SHA-256 hashes of the existing assets
+// of a version, keyed by extension, with the assets to publish
+func checkExistingAssets(modPath, version string, existing map[string]string, unfinished bool, goMod, info, zip, hashes, sig Asset, opts PutOptions) (versionState, error) {
+	assets := map[string]Asset{
+		".info":   info,
+		".mod":    goMod,
+		".zip":    zip,
+		".hashes": hashes,
+		".sig":    sig,
+	}
+
+	var matched, different []string
+	for ext, asset := range assets {
+		hash, ok := existing[ext]
+		if !ok {
+			continue
+		}
+		if asset == nil || hash != asset.SHA256() {
+			different = append(different, version+ext)
+		}
+		matched = append(matched, version+ext)
+	}
+	sort.Strings(matched)
+	sort.Strings(different)
+
+	if len(matched) == 0 && !unfinished {
+		return versionNotPublished, nil
+	}
+
+	if opts.Force {
+		logf("Replacing existing version: %v@%v", modPath, version)
+		return versionReplaced, nil
+	}
+
+	complete := !unfinished
+	for _, ext := range []string{".info", ".mod", ".zip"} {
+		if _, ok := existing[ext]; !ok {
+			complete = false
+		}
+	}
+
+	if complete {
+		// Only the module content and whether the version is signed are compared,
+		// as the `.info` (and so the `.hashes` and `.sig`) records the Git origin
+		differentContent := slices.DeleteFunc(slices.Clone(different), func(name string) bool {
+			ext := path.Ext(name)
+			return ext != ".mod" && ext != ".zip" && !(ext == ".sig" && sig == nil)
+		})
+		if len(differentContent) > 0 {
+			return 0, fmt.Errorf("Version already published with different content: %v@%v: %v (use --force to overwrite)", modPath, version, strings.Join(differentContent, ", "))
+		}
+		logf("Version already published with identical content: %v@%v", modPath, version)
+		return versionPublished, nil
+	}
+
+	if opts.Discard {
+		logf("Discarding unfinished version: %v@%v: %v", modPath, version, strings.Join(matched, ", "))
+		return versionReplaced, nil
+	}
+
+	if len(different) > 0 {
+		return 0, fmt.Errorf("Version partially published with different content: %v@%v: %v (use --discard to delete and publish again)", modPath, version, strings.Join(different, ", "))
+	}
+
+	if opts.Resume {
+		logf("Resuming unfinished version: %v@%v: %v", modPath, version, strings.Join(matched, ", "))
+		return versionUnfinished, nil
+	}
+
+	return 0, fmt.Errorf("Version partially published by an interrupted publish: %v@%v: %v (use --resume to finish publishing or --discard to delete and publish again)", modPath, version, strings.Join(matched, ", "))
+}
+
+// proxyTree reads and writes the files of a module
+// in a repository laid out like a GOPROXY tree
+type proxyTree interface {
+	// sha256 returns the SHA-256 hash of the file
+	// and reports false if the file does not exist
+	sha256(name string) (string, bool, error)
+	// read returns the file and reports false if the file does not exist
+	read(name string) ([]byte, bool, error)
+	write(name string, asset Asset) error
+	remove(name string) error
+	// forbidden reports whether the error is for a file
+	// that either does not exist or can not be read
+	forbidden(err error) bool
+}
+
+// putProxyTree publishes the assets of a version to the tree and adds the version to the version list
+func putProxyTree(tree proxyTree, modPath, version string, goMod, info, zip, hashes, sig Asset, opts PutOptions) error {
+	escapedVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return fmt.Errorf("Error escaping version: %v: %w", version, err)
+	}
+
+	// The version list is updated with a read-modify-write
+	// which is not safe for concurrent publishes of the same module
+	listData, _, listErr := tree.read("@v/list")
+	if listErr != nil && !tree.forbidden(listErr) {
+		return listErr
+	}
+
+	// Assets are written before the version list is updated so that a partially
+	// published version is never listed, and the hashes are written first
+	assets := []struct {
+		ext   string
+		asset Asset
+	}{
+		{".sig", sig},
+		{".hashes", hashes},
+		{".info", info},
+		{".mod", goMod},
+		{".zip", zip},
+	}
+
+	existing := map[string]string{}
+	var forbiddenErr error
+	for _, asset := range assets {
+		hash, ok, err := tree.sha256("@v/" + escapedVersion + asset.ext)
+		if err != nil && tree.forbidden(err) {
+			forbiddenErr = err
+			continue
+		} else if err != nil {
+			return err
+		}
+		if ok {
+			existing[asset.ext] = hash
+		}
+	}
+
+	// Forbidden assets are only treated as missing if another asset of
+	// the version, or the version list without the version, can be read
+	readable := len(existing) > 0 || (listErr == nil && !versionListed(listData, version))
+	if forbiddenErr != nil && !readable && !opts.Force {
+		return fmt.Errorf("Unable to check existing assets, grant s3:ListBucket or use --force: %v@%v: %w", modPath, version, forbiddenErr)
+	}
+
+	state, err := checkExistingAssets(modPath, version, existing, false, goMod, info, zip, hashes, sig, opts)
+	if err != nil {
+		return err
+	}
+
+	// The version list is still updated for an already published
+	// version in case a previous publish failed before updating it
+	if state != versionPublished {
+		for _, asset := range assets {
+			name := "@v/" + escapedVersion + asset.ext
+
+			// The signature of a replaced version that is no longer signed is removed
+			if asset.asset == nil {
+				if _, ok := existing[asset.ext]; ok {
+					err = tree.remove(name)
+					if err != nil {
+						return err
+					}
+				}
+				continue
+			}
+
+			err = tree.write(name, asset.asset)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	listData, updated := appendVersionList(listData, version)
+	if !updated {
+		return nil
+	}
+
+	return tree.write("@v/list", newBytesAsset(listData))
+}
+
+// appendVersionList appends the version to the `@v/list` data and
+// reports false if the version was already listed (or is a
+// pseudo-version, see listedVersions)
+func appendVersionList(listData []byte, version string) ([]byte, bool) {
+	if module.IsPseudoVersion(version) || versionListed(listData, version) {
+		return listData, false
+	}
+
+	listBuf := bytes.NewBuffer(nil)
+	listBuf.Write(listData)
+	if listBuf.Len() > 0 && !bytes.HasSuffix(listData, []byte("\n")) {
+		listBuf.WriteString("\n")
+	}
+	fmt.Fprintf(listBuf, "%v\n", version)
+
+	return listBuf.Bytes(), true
+}
+
+// versionListed reports whether the version is in the `@v/list` data
+func versionListed(listData []byte, version string) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(listData))
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == version {
+			return true
+		}
+	}
+	return false
+}
+
+// sortVersions returns the valid semantic versions
+// sorted in ascending order with duplicates removed
+func sortVersions(versions []string) []string {
+	var sorted []string
+	for _, version := range versions {
+		if semver.IsValid(version) {
+			sorted = append(sorted, version)
+		}
+	}
+	semver.Sort(sorted)
+	return slices.Compact(sorted)
+}
+
+// listedVersions returns the versions without pseudo-versions,
+// which are not listed, as required by the GOPROXY protocol
+func listedVersions(versions []string) []string {
+	var listed []string
+	for _, version := range versions {
+		if !module.IsPseudoVersion(version) {
+			listed = append(listed, version)
+		}
+	}
+	return listed
+}
+
+// latestVersion returns the highest release, prerelease or pseudo-version,
+// in that order, like the go command resolves the `@latest` query
+func latestVersion(versions []string) string {
+	var latestRelease, latestPrerelease, latestPseudo string
+	for _, version := range versions {
+		if !semver.IsValid(version) {
+			continue
+		}
+		if module.IsPseudoVersion(version) {
+			if latestPseudo == "" || semver.Compare(version, latestPseudo) > 0 {
+				latestPseudo = version
+			}
+		} else if semver.Prerelease(version) == "" {
+			if latestRelease == "" || semver.Compare(version, latestRelease) > 0 {
+				latestRelease = version
+			}
+		} else {
+			if latestPrerelease == "" || semver.Compare(version, latestPrerelease) > 0 {
+				latestPrerelease = version
+			}
+		}
+	}
+
+	if latestRelease != "" {
+		return latestRelease
+	}
+	if latestPrerelease != "" {
+		return latestPrerelease
+	}
+	return latestPseudo
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -19,3 +23,119 @@ func chdir(t *testing.T, dir string) {
 		require.Nilf(t, err, "Error reverting working directory: %v", err)
 	})
 }
+
+// isolateConfig isolates loading the default config from the user config
+// file, GOXM_CONFIG and `.goxm.json` files above the ceiling directory
+func isolateConfig(t *testing.T, ceilingDir string) string {
+	ceilingDir, err := filepath.Abs(ceilingDir)
+	require.Nilf(t, err, "Error resolving ceiling directory: %v", err)
+
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	t.Setenv("GOXM_CONFIG", "")
+
+	prevUserConfigDir, prevCeilingDir := userConfigDir, configCeilingDir
+	userConfigDir = func() (string, error) { return configDir, nil }
+	configCeilingDir = ceilingDir
+
+	t.Cleanup(func() {
+		userConfigDir, configCeilingDir = prevUserConfigDir, prevCeilingDir
+	})
+
+	return configDir
+}
+
+// gitInit creates a Git repository in a temporary directory
+func gitInit(t *testing.T) string {
+	dir := t.TempDir()
+	git(t, dir, "init", "--quiet", "--initial-branch=main")
+	return dir
+}
+
+// gitCommit writes the files and commits them to the Git repository
+func gitCommit(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755)
+		require.Nil(t, err)
+
+		err = os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+		require.Nil(t, err)
+	}
+	git(t, dir, "add", "--all")
+	git(t, dir, "commit", "--quiet", "--message=commit")
+}
+
+func git(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=goxm",
+		"GIT_AUTHOR_EMAIL=goxm@example.com",
+		"GIT_AUTHOR_DATE=2024-03-03T17:24:35Z",
+		"GIT_COMMITTER_NAME=goxm",
+		"GIT_COMMITTER_EMAIL=goxm@example.com",
+		"GIT_COMMITTER_DATE=2024-03-03T17:24:35Z",
+	)
+
+	output, err := cmd.CombinedOutput()
+	require.Nilf(t, err, "Error running git: %v: %s", args, output)
+
+	return strings.TrimSpace(string(output))
+}
+
+func TestLatestVersion(t *testing.T) {
+	require.Equal(t, "", latestVersion(nil))
+	require.Equal(t, "v1.10.0", latestVersion([]string{"v1.2.0", "v1.10.0", "v1.9.0", "v2.0.0-rc.1"}))
+	require.Equal(t, "v2.0.0-rc.2", latestVersion([]string{"v2.0.0-rc.1", "v2.0.0-rc.2", "v1.0.0-beta"}))
+	require.Equal(t, "v2.0.0+incompatible", latestVersion([]string{"v1.0.0", "v2.0.0+incompatible", "invalid"}))
+
+	// Pseudo-versions are only latest if there are no tagged versions
+	require.Equal(t, "v1.0.0-rc.1", latestVersion([]string{"v1.0.0-rc.1", "v1.0.0-rc.1.0.20240303172435-0123456789ab"}))
+	require.Equal(t, "v0.0.0-20240304172435-0123456789ab", latestVersion([]string{"v0.0.0-20240303172435-0123456789ab", "v0.0.0-20240304172435-0123456789ab"}))
+}
+
+func TestSortVersions(t *testing.T) {
+	require.Equal(t,
+		[]string{"v0.9.0", "v0.10.0-rc.1", "v0.10.0", "v1.0.0"},
+		sortVersions([]string{"v0.10.0", "v1.0.0", "invalid", "v0.9.0", "v0.10.0-rc.1", "v0.10.0"}),
+	)
+}
+
+func TestListedVersions(t *testing.T) {
+	require.Equal(t,
+		[]string{"v1.0.0-rc.1", "v1.0.0"},
+		listedVersions([]string{"v1.0.0-rc.1", "v1.0.0-rc.1.0.20240303172435-0123456789ab", "v1.0.0"}),
+	)
+}
+
+func TestAppendVersionList(t *testing.T) {
+	listData, updated := appendVersionList([]byte("v0.1.0"), "v0.2.0")
+	require.True(t, updated)
+	require.Equal(t, "v0.1.0\nv0.2.0\n", string(listData))
+
+	_, updated = appendVersionList(listData, "v0.1.0")
+	require.False(t, updated)
+
+	// Pseudo-versions are not listed
+	_, updated = appendVersionList(listData, "v0.2.1-0.20240303172435-0123456789ab")
+	require.False(t, updated)
+}
+
+func TestGetGoModule(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module github.com/go-goxm/module1\n\ngo 1.20\n"), 0o644)
+	require.Nil(t, err)
+
+	goModName, _, _, err := getGoModule(context.Background())
+	require.Nil(t, err, err)
+	require.Equal(t, "github.com/go-goxm/module1", goModName)
+
+	// A go.mod file without a module directive is an error
+	err = os.WriteFile(filepath.Join(dir, "go.mod"), []byte("go 1.20\n"), 0o644)
+	require.Nil(t, err)
+
+	_, _, _, err = getGoModule(context.Background())
+	require.ErrorContains(t, err, "Go module name not found")
+}
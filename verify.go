@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// AssetHashes is the content of the `.hashes` asset published with each
+// version, so that downloaded assets can be verified against the content
+// that was published
+type AssetHashes struct {
+	// Path and Version identify the module version, like a checksum
+	// database record, so that the hashes (and the signature of the
+	// hashes) can not be copied to another version
+	Path    string
+	Version string
+
+	// Sum and GoModSum are the `h1:` hashes of the zip and go.mod
+	// files, as recorded in go.sum by the go command
+	Sum      string
+	GoModSum string
+
+	// SHA256 is the SHA-256 hash of each asset keyed by extension
+	SHA256 map[string]string
+}
+
+// goModSum returns the `h1:` hash of the go.mod file, as recorded in go.sum
+func goModSum(goModData []byte) (string, error) {
+	return dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(goModData)), nil
+	})
+}
+
+// verify checks the asset against the hashes and returns an error
+// describing the first hash that does not match
+func (h *AssetHashes) verify(modPath, attifact string, asset *fileAsset) error {
+	ext := path.Ext(attifact)
+
+	if h.SHA256[ext] != asset.SHA256() {
+		return fmt.Errorf("Asset content does not match the hash recorded when published: %v/%v: SHA-256 %v != %v", modPath, attifact, asset.SHA256(), h.SHA256[ext])
+	}
+
+	var sum, expectedSum string
+	var err error
+	switch ext {
+	case ".zip":
+		sum, err = dirhash.HashZip(asset.name, dirhash.Hash1)
+		expectedSum = h.Sum
+	case ".mod":
+		var goModData []byte
+		goModData, err = os.ReadFile(asset.name)
+		if err == nil {
+			sum, err = goModSum(goModData)
+		}
+		expectedSum = h.GoModSum
+	default:
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Error hashing asset: %v/%v: %w", modPath, attifact, err)
+	}
+
+	if sum != expectedSum {
+		return fmt.Errorf("Asset content does not match the hash recorded when published: %v/%v: %v != %v", modPath, attifact, sum, expectedSum)
+	}
+	return nil
+}
+
+// verifyAsset verifies the versioned asset read from the repository against
+// the published hashes and spools it to a file removed when closed
+func verifyAsset(ctx context.Context, config *Config, repository Repository, signatures *Signatures, modPath, attifact string, reader io.ReadCloser) (io.ReadCloser, error) {
+	asset, ok := strings.CutPrefix(attifact, "@v/")
+	ext := path.Ext(asset)
+	if !ok || !slices.Contains([]string{".info", ".mod", ".zip"}, ext) {
+		return reader, nil
+	}
+
+	// GOPROXY servers do not hold the hashes published by goxm, so their
+	// assets are only verified if signatures are verified
+	verifySignatures := signatures != nil && signatures.VerifySignatures
+	if _, ok := repository.(*GoProxyRepoConfig); ok && !verifySignatures {
+		return reader, nil
+	}
+
+	hashes, err := readVersionHashes(ctx, config, repository, signatures, modPath, strings.TrimSuffix(asset, ext))
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	if hashes == nil {
+		logf("Asset not verified, version published without hashes: %v/%v", modPath, attifact)
+		return reader, nil
+	}
+
+	spooled, err := newFileAsset("goxm-*"+ext, func(w io.Writer) error {
+		_, err := io.Copy(w, reader)
+		return err
+	})
+	reader.Close()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading asset: %v/%v: %w", modPath, attifact, err)
+	}
+
+	err = hashes.verify(modPath, attifact, spooled)
+	if err == nil {
+		reader, err = spooled.Open()
+	}
+	if err != nil {
+		spooled.Remove()
+		return nil, err
+	}
+
+	return &removeOnClose{ReadCloser: reader, asset: spooled}, nil
+}
+
+// readVersionHashes reads the hashes published with the version,
+// or returns nil if the version was published without hashes
+func readVersionHashes(ctx context.Context, config *Config, repository Repository, signatures *Signatures, modPath, version string) (*AssetHashes, error) {
+	var hashesData []byte
+	var err error
+	if signatures != nil && signatures.VerifySignatures {
+		var sigData []byte
+		sigData, err = readAsset(ctx, config, repository, modPath, "@v/"+version+".sig")
+		if err != nil {
+			return nil, fmt.Errorf("Version not signed: %v@%v: %w", modPath, version, err)
+		}
+
+		hashesData, err = signatures.open(sigData)
+		if err != nil {
+			return nil, fmt.Errorf("Version signature not verified: %v@%v: %w", modPath, version, err)
+		}
+	} else {
+		hashesData, err = readAsset(ctx, config, repository, modPath, "@v/"+version+".hashes")
+		if isAssetNotFound(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error reading asset hashes: %v@%v: %w", modPath, version, err)
+		}
+	}
+
+	var hashes AssetHashes
+	err = json.Unmarshal(hashesData, &hashes)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading asset hashes: %v@%v: %w", modPath, version, err)
+	}
+
+	unescapedVersion, err := module.UnescapeVersion(version)
+	if err != nil {
+		return nil, fmt.Errorf("Error unescaping version: %v: %w", version, err)
+	}
+	if hashes.Path != modPath || hashes.Version != unescapedVersion {
+		return nil, fmt.Errorf("Asset hashes published for another version: %v@%v: %v@%v", modPath, unescapedVersion, hashes.Path, hashes.Version)
+	}
+
+	return &hashes, nil
+}
+
+// readAsset reads the asset from the repository, or the cache if configured
+func readAsset(ctx context.Context, config *Config, repository Repository, modPath, attifact string) ([]byte, error) {
+	reader, _, err := getAsset(ctx, config, repository, modPath, attifact)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+// removeOnClose removes the temporary file of the asset when closed
+type removeOnClose struct {
+	io.ReadCloser
+	asset *fileAsset
+}
+
+func (r *removeOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	if removeErr := r.asset.Remove(); err == nil {
+		err = removeErr
+	}
+	return err
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+func TestVerifyAsset(t *testing.T) {
+	repo := &FileSystemRepoConfig{Path: t.TempDir()}
+
+	goModData := readFile(t, "./testdata/ca_module1_assets/v0.1.0.mod")
+	infoData := readFile(t, "./testdata/ca_module1_assets/v0.1.0.info")
+	zipData := readFile(t, "./testdata/ca_module1_assets/v0.1.0.zip")
+
+	for _, version := range []string{"v0.1.0", "v0.2.0", "v0.3.0"} {
+		err := repo.Put(
+			context.Background(),
+			"github.com/go-goxm/ca_module1",
+			version,
+			newBytesAsset(goModData),
+			newBytesAsset(infoData),
+			newBytesAsset(zipData),
+			newTestAssetHashes(t, "github.com/go-goxm/ca_module1", version, goModData, infoData, zipData),
+			nil,
+			PutOptions{},
+		)
+		require.Nil(t, err, err)
+	}
+
+	countingRepo := &testCountingRepo{
+		Repository: repo,
+		errors: map[string]error{
+			"@v/v0.3.0.hashes": errors.New("Rate exceeded"),
+		},
+	}
+
+	config, err := newConfig(map[string]Repository{
+		"github.com/go-goxm/*": countingRepo,
+	})
+	require.Nil(t, err, err)
+	config.Cache = &Cache{Dir: t.TempDir(), TTL: time.Hour}
+
+	server := httptest.NewServer(newProxyHandler(config))
+	defer server.Close()
+
+	versionDir := filepath.Join(repo.Path, "github.com/go-goxm/ca_module1/@v")
+
+	// Assets changed after publishing are not served
+	require.Nil(t, os.WriteFile(filepath.Join(versionDir, "v0.2.0.mod"), []byte("module github.com/go-goxm/changed\n"), 0o644))
+	require.Nil(t, os.WriteFile(filepath.Join(versionDir, "v0.2.0.zip"), []byte("changed"), 0o644))
+
+	// Versions published without hashes are not verified
+	require.Nil(t, os.Remove(filepath.Join(versionDir, "v0.1.0.hashes")))
+	require.Nil(t, os.WriteFile(filepath.Join(versionDir, "v0.1.0.info"), []byte("{}"), 0o644))
+
+	expectedResponses := map[string]int{
+		"/github.com/go-goxm/ca_module1/@v/v0.1.0.info": http.StatusOK,
+		"/github.com/go-goxm/ca_module1/@v/v0.1.0.mod":  http.StatusOK,
+		"/github.com/go-goxm/ca_module1/@v/v0.2.0.info": http.StatusOK,
+		"/github.com/go-goxm/ca_module1/@v/v0.2.0.mod":  http.StatusForbidden,
+		"/github.com/go-goxm/ca_module1/@v/v0.2.0.zip":  http.StatusForbidden,
+		"/github.com/go-goxm/ca_module1/@v/v0.3.0.info": http.StatusForbidden,
+		"/github.com/go-goxm/ca_module1/@v/v0.3.0.mod":  http.StatusForbidden,
+		"/github.com/go-goxm/ca_module1/@v/list":        http.StatusOK,
+	}
+
+	for requestPath, expectedStatus := range expectedResponses {
+		resp, err := http.Get(server.URL + requestPath)
+		require.Nil(t, err, err)
+		resp.Body.Close()
+		require.Equal(t, expectedStatus, resp.StatusCode, requestPath)
+	}
+
+	// The hashes are read through the cache, except for versions published
+	// without hashes and errors reading them
+	require.Equal(t, 2, countingRepo.gets["@v/v0.1.0.hashes"])
+	require.Equal(t, 1, countingRepo.gets["@v/v0.2.0.hashes"])
+	require.Equal(t, 2, countingRepo.gets["@v/v0.3.0.hashes"])
+
+	// Hashes are checked after the SHA-256 hash
+	hashes := &AssetHashes{SHA256: map[string]string{".mod": newBytesAsset(goModData).SHA256()}, GoModSum: "h1:changed="}
+	asset, err := newFileAsset("goxm-*.mod", func(w io.Writer) error {
+		_, err := w.Write(goModData)
+		return err
+	})
+	require.Nil(t, err, err)
+	defer asset.Remove()
+
+	err = hashes.verify("github.com/go-goxm/ca_module1", "@v/v0.2.0.mod", asset)
+	require.ErrorContains(t, err, "Asset content does not match the hash recorded when published: github.com/go-goxm/ca_module1/@v/v0.2.0.mod: h1:")
+}
+
+func TestVerifyAssetS3(t *testing.T) {
+	client := &MockS3Client{Objects: map[string][]byte{}}
+	repo := &S3RepoConfig{Bucket: aws.String("TestBucket"), client: client}
+
+	goModData := readFile(t, "./testdata/ca_module1_assets/v0.1.0.mod")
+	infoData := readFile(t, "./testdata/ca_module1_assets/v0.1.0.info")
+	zipData := readFile(t, "./testdata/ca_module1_assets/v0.1.0.zip")
+
+	for _, version := range []string{"v0.1.0", "v0.2.0"} {
+		err := repo.Put(
+			context.Background(),
+			"github.com/go-goxm/ca_module1",
+			version,
+			newBytesAsset(goModData),
+			newBytesAsset(infoData),
+			newBytesAsset(zipData),
+			newTestAssetHashes(t, "github.com/go-goxm/ca_module1", version, goModData, infoData, zipData),
+			nil,
+			PutOptions{},
+		)
+		require.Nil(t, err, err)
+	}
+
+	config, err := newConfig(map[string]Repository{
+		"github.com/go-goxm/*": repo,
+	})
+	require.Nil(t, err, err)
+
+	server := httptest.NewServer(newProxyHandler(config))
+	defer server.Close()
+
+	// Without the `s3:ListBucket` permission, S3 responds with
+	// `Forbidden` for the hashes of versions published without hashes
+	client.ListBucketDenied = true
+	delete(client.Objects, "TestBucket/github.com/go-goxm/ca_module1/@v/v0.1.0.hashes")
+	client.Objects["TestBucket/github.com/go-goxm/ca_module1/@v/v0.2.0.mod"] = []byte("module github.com/go-goxm/changed\n")
+
+	expectedResponses := map[string]int{
+		"/github.com/go-goxm/ca_module1/@v/v0.1.0.mod": http.StatusOK,
+		"/github.com/go-goxm/ca_module1/@v/v0.2.0.mod": http.StatusForbidden,
+		"/github.com/go-goxm/ca_module1/@v/v0.2.0.zip": http.StatusOK,
+	}
+
+	for requestPath, expectedStatus := range expectedResponses {
+		resp, err := http.Get(server.URL + requestPath)
+		require.Nil(t, err, err)
+		resp.Body.Close()
+		require.Equal(t, expectedStatus, resp.StatusCode, requestPath)
+	}
+}
+
+func TestVerifyAssetGoProxy(t *testing.T) {
+	var requests []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		requests = append(requests, req.URL.Path)
+		if path.Ext(req.URL.Path) == ".hashes" {
+			resp.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		io.WriteString(resp, "module github.com/go-goxm/module1\n")
+	}))
+	defer upstream.Close()
+
+	config, err := LoadConfig(strings.NewReader(`{
+		"repos": {
+			"github.com/go-goxm/*": {"type": "goproxy", "url": "` + upstream.URL + `"}
+		}
+	}`))
+	require.Nilf(t, err, "Error loading config: %v", err)
+
+	server := httptest.NewServer(newProxyHandler(config))
+	defer server.Close()
+
+	// Assets of GOPROXY servers are served without reading hashes
+	resp, err := http.Get(server.URL + "/github.com/go-goxm/module1/@v/v0.1.0.mod")
+	require.Nil(t, err, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, []string{"/github.com/go-goxm/module1/@v/v0.1.0.mod"}, requests)
+}
+
+// newTestAssetHashes returns the `.hashes` asset for the asset content
+func newTestAssetHashes(t *testing.T, modPath, version string, goModData, infoData, zipData []byte) Asset {
+	zipPath := filepath.Join(t.TempDir(), "module.zip")
+	require.Nil(t, os.WriteFile(zipPath, zipData, 0o644))
+
+	zipSum, err := dirhash.HashZip(zipPath, dirhash.Hash1)
+	require.Nil(t, err, err)
+
+	modSum, err := goModSum(goModData)
+	require.Nil(t, err, err)
+
+	hashesData, err := json.Marshal(&AssetHashes{
+		Path:     modPath,
+		Version:  version,
+		Sum:      zipSum,
+		GoModSum: modSum,
+		SHA256: map[string]string{
+			".info": newBytesAsset(infoData).SHA256(),
+			".mod":  newBytesAsset(goModData).SHA256(),
+			".zip":  newBytesAsset(zipData).SHA256(),
+		},
+	})
+	require.Nil(t, err, err)
+
+	return newBytesAsset(append(hashesData, '\n'))
+}
+
+// testCountingRepo counts the assets read from the
+// repository and fails reading the assets with errors
+type testCountingRepo struct {
+	Repository
+	errors map[string]error
+
+	mu   sync.Mutex
+	gets map[string]int
+}
+
+func (r *testCountingRepo) Get(ctx context.Context, modPath, attifact string) (io.ReadCloser, int, error) {
+	r.mu.Lock()
+	if r.gets == nil {
+		r.gets = map[string]int{}
+	}
+	r.gets[attifact]++
+	r.mu.Unlock()
+
+	if err := r.errors[attifact]; err != nil {
+		return nil, http.StatusForbidden, err
+	}
+	return r.Repository.Get(ctx, modPath, attifact)
+}